@@ -1,28 +1,70 @@
 package common
 
 import (
+  "math"
   "math/rand"
 )
 
+// how many values a multi-value field generates, e.g. [3], [0, 5], or [1, 10, "geometric"]
 type Bound struct {
   Min int
   Max int
+  Distribution string // how amounts between Min and Max are spread; uniform if empty
+}
+
+// the distributions a bound may name, the first of which is the default
+var Distributions = []string{"uniform", "normal", "geometric"}
+
+func IsDistribution(name string) bool {
+  for _, d := range Distributions {
+    if d == name {
+      return true
+    }
+  }
+  return false
 }
 
 func(b *Bound) Multiple() bool {
   return b != nil
 }
 
-func (b *Bound) Amount() int {
-  return determineAmount(b.Min, b.Max)
+func (b *Bound) Amount(rng *rand.Rand) int {
+  switch b.Distribution {
+  case "normal":
+    return normalAmount(rng, b.Min, b.Max)
+  case "geometric":
+    return geometricAmount(rng, b.Min, b.Max)
+  default:
+    return determineAmount(rng, b.Min, b.Max)
+  }
 }
 
-func determineAmount(min int, max int) int {
-  if max == 0 && min == 0 {
-    return 1
-  } else if max - min == 0 {
+func determineAmount(rng *rand.Rand, min int, max int) int {
+  if max - min == 0 {
     return min
   }
 
-  return rand.Intn(max - min + 1) + min
+  return rng.Intn(max - min + 1) + min
+}
+
+// most often halfway between min and max, and rarely at either end
+func normalAmount(rng *rand.Rand, min int, max int) int {
+  mean, stddev := float64(min + max) / 2, float64(max - min) / 6
+  amount := int(math.Floor(rng.NormFloat64() * stddev + mean + 0.5))
+
+  if amount < min {
+    return min
+  } else if amount > max {
+    return max
+  }
+  return amount
+}
+
+// min is the most likely, and each amount above it is half as likely as the one before
+func geometricAmount(rng *rand.Rand, min int, max int) int {
+  amount := min
+  for amount < max && rng.Intn(2) == 1 {
+    amount++
+  }
+  return amount
 }
@@ -2,26 +2,55 @@ package common
 
 import (
 	. "github.com/ThoughtWorksStudios/bobcat/test_helpers"
+	"math/rand"
 	"testing"
 )
 
+var rng = rand.New(rand.NewSource(1))
+
 func TestAmountWithZeroAsBounds(t *testing.T) {
-	actual := determineAmount(0, 0)
+	actual := determineAmount(rng, 0, 0)
 
-	AssertEqual(t, 1, actual)
+	AssertEqual(t, 0, actual)
 }
 
 func TestAmountWithSameValueAsBounds(t *testing.T) {
-	actual := determineAmount(4, 4)
+	actual := determineAmount(rng, 4, 4)
 
 	AssertEqual(t, 4, actual)
 }
 
 func TestAmountWithInMinAndMax(t *testing.T) {
 	min, max := 4, 7
-	actual := determineAmount(min, max)
+	actual := determineAmount(rng, min, max)
 
 	if actual < min || actual > max {
 		t.Errorf("Generated value '%v' is outside of expected range min: '%v', max: '%v'", actual, min, max)
 	}
 }
+
+func TestAmountWithDistributionsStaysWithinBounds(t *testing.T) {
+	for _, distribution := range Distributions {
+		bound := &Bound{Min: 2, Max: 6, Distribution: distribution}
+		seen := make(map[int]bool)
+
+		for i := 0; i < 500; i++ {
+			actual := bound.Amount(rng)
+			if actual < 2 || actual > 6 {
+				t.Errorf("Generated value '%v' is outside of expected range min: '2', max: '6' with %s distribution", actual, distribution)
+			}
+			seen[actual] = true
+		}
+
+		AssertEqual(t, 5, len(seen), "Expected every amount from 2 to 6 with %s distribution", distribution)
+	}
+}
+
+func TestGeometricAmountFavorsTheMinimum(t *testing.T) {
+	counts := make(map[int]int)
+	for i := 0; i < 1000; i++ {
+		counts[geometricAmount(rng, 0, 10)]++
+	}
+
+	Assert(t, counts[0] > counts[1] && counts[1] > counts[3], "Expected smaller amounts to be more likely, but got %v", counts)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/ThoughtWorksStudios/bobcat/dictionary"
+	"log"
+	"os"
+	"text/tabwriter"
+)
+
+func printDictHelpAndExit() {
+	log.Print("Usage: ./bobcat dict list [ -d custom_dict_dir ]")
+	log.Print("       ./bobcat dict sample [ -d custom_dict_dir ] [ -n count ] dictionary_name")
+	log.Print("       ./bobcat dict validate custom_dict_dir")
+	os.Exit(1)
+}
+
+func runDictCommand(args []string) {
+	if len(args) == 0 {
+		printDictHelpAndExit()
+	}
+
+	switch args[0] {
+	case "list":
+		listDictionaries(args[1:])
+	case "sample":
+		sampleDictionary(args[1:])
+	case "validate":
+		validateDictionaries(args[1:])
+	default:
+		log.Printf("Unknown dict command %q", args[0])
+		printDictHelpAndExit()
+	}
+}
+
+func listDictionaries(args []string) {
+	flags := flag.NewFlagSet("dict list", flag.ExitOnError)
+	customDicts := flags.String("d", "", "location of custom dictionary files")
+	flags.Parse(args)
+
+	entries, err := dictionary.New(*customDicts).Catalog()
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tKIND\tSOURCE\tENTRIES")
+
+	for _, entry := range entries {
+		source := entry.Source
+		if entry.Shadowed {
+			source += " (overridden by custom)"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\n", entry.Name, entry.Kind(), source, entry.Count)
+	}
+
+	w.Flush()
+}
+
+func sampleDictionary(args []string) {
+	flags := flag.NewFlagSet("dict sample", flag.ExitOnError)
+	customDicts := flags.String("d", "", "location of custom dictionary files")
+	count := flags.Int("n", 5, "number of values to sample")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		log.Print("You must pass in a dictionary name")
+		printDictHelpAndExit()
+	}
+
+	values, err := dictionary.New(*customDicts).Sample(flags.Arg(0), *count)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	for _, value := range values {
+		fmt.Println(value)
+	}
+}
+
+func validateDictionaries(args []string) {
+	if len(args) != 1 {
+		log.Print("You must pass in a custom dictionary directory")
+		printDictHelpAndExit()
+	}
+
+	problems, err := dictionary.ValidateDirectory(args[0])
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	for _, problem := range problems {
+		log.Println(problem)
+	}
+
+	if len(problems) > 0 {
+		log.Fatalf("Found %d problem(s) in %s", len(problems), args[0])
+	}
+
+	log.Println("Dictionaries OK")
+}
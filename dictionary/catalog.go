@@ -0,0 +1,191 @@
+package dictionary
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	BuiltinSource = "builtin"
+	CustomSource  = "custom"
+)
+
+// describes a single dictionary or format file available to `dict()` fields
+type Entry struct {
+	Name     string
+	Source   string
+	Count    int
+	Format   bool
+	Shadowed bool // true when a custom entry of the same name takes precedence
+}
+
+func (e Entry) Kind() string {
+	if e.Format {
+		return "format"
+	}
+	return "dictionary"
+}
+
+// Catalog lists the embedded dictionaries for the current language alongside
+// those found in the custom directory, if one was given. Custom dictionaries win
+// on name conflicts, just as they do in ValueFromDictionary(), so the builtin
+// entry is marked as shadowed.
+func (d *Dictionary) Catalog() ([]Entry, error) {
+	custom := make(map[string]Entry)
+
+	if customDir := d.customDataLocation; customDir != "" {
+		files, err := ioutil.ReadDir(customDir)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, info := range files {
+			if !isDictionaryFile(info) {
+				continue
+			}
+
+			lines, err := readLines(filepath.Join(customDir, info.Name()))
+			if err != nil {
+				return nil, err
+			}
+
+			custom[info.Name()] = newEntry(info.Name(), CustomSource, lines)
+		}
+	}
+
+	entries := make([]Entry, 0, len(data)+len(custom))
+	prefix := fmt.Sprintf("/data/%s/", d.lang)
+
+	for key, f := range data {
+		if f.isDir || !strings.HasPrefix(key, prefix) {
+			continue
+		}
+
+		name := strings.TrimPrefix(key, prefix)
+		content, err := FSString(false, key)
+		if err != nil {
+			return nil, err
+		}
+
+		entry := newEntry(name, BuiltinSource, strings.Split(strings.TrimSpace(content), "\n"))
+		_, entry.Shadowed = custom[name]
+		entries = append(entries, entry)
+	}
+
+	for _, entry := range custom {
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(a, b int) bool {
+		if entries[a].Name == entries[b].Name {
+			return entries[a].Source == CustomSource
+		}
+		return entries[a].Name < entries[b].Name
+	})
+
+	return entries, nil
+}
+
+func newEntry(name, source string, lines []string) Entry {
+	return Entry{Name: name, Source: source, Count: len(lines), Format: strings.HasSuffix(name, "_format")}
+}
+
+// Sample generates n values from a dictionary or format, after verifying that
+// the category (and any format it uses) resolves.
+func (d *Dictionary) Sample(cat string, n int) ([]string, error) {
+	if err := d.ValidateCategory(cat); err != nil {
+		return nil, err
+	}
+
+	values := make([]string, n)
+	for i := 0; i < n; i++ {
+		if strings.HasSuffix(cat, "_format") {
+			values[i] = d.valueFromFormat(d.tryLookup(cat, r), r)
+		} else {
+			values[i] = d.ValueFromDictionary(cat)
+		}
+	}
+	return values, nil
+}
+
+// ValidateDirectory inspects every file in a custom dictionary directory,
+// reporting empty lines, duplicate entries, and formats that refer to
+// dictionaries which resolve neither in dir nor among the builtins.
+func ValidateDirectory(dir string) ([]error, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	d := New(dir)
+	problems := make([]error, 0)
+
+	for _, info := range files {
+		if !isDictionaryFile(info) {
+			continue
+		}
+
+		path := filepath.Join(dir, info.Name())
+		lines, err := readLines(path)
+		if err != nil {
+			return nil, err
+		}
+
+		firstSeen := make(map[string]int)
+
+		for idx, line := range lines {
+			lineNum := idx + 1
+
+			if strings.TrimSpace(line) == "" {
+				problems = append(problems, fmt.Errorf("%s:%d: empty entry", path, lineNum))
+				continue
+			}
+
+			if first, dupe := firstSeen[line]; dupe {
+				problems = append(problems, fmt.Errorf("%s:%d: duplicate entry %q (first seen on line %d)", path, lineNum, line, first))
+			} else {
+				firstSeen[line] = lineNum
+			}
+		}
+
+		if strings.HasSuffix(info.Name(), "_format") {
+			if err := d.validateFormat(info.Name(), map[string]bool{}); err != nil {
+				problems = append(problems, fmt.Errorf("%s: %v", path, err))
+			}
+		}
+	}
+
+	return problems, nil
+}
+
+// custom dictionaries usually live alongside the spec files that use them, so skip those
+func isDictionaryFile(info os.FileInfo) bool {
+	return !info.IsDir() && !strings.HasPrefix(info.Name(), ".") && filepath.Ext(info.Name()) != ".lang"
+}
+
+// reads the entries of a dictionary file, ignoring trailing newlines just like populateSamples()
+func readLines(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	lines := make([]string, 0)
+	scanner := bufio.NewScanner(f)
+
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	return lines, scanner.Err()
+}
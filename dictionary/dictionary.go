@@ -3,125 +3,176 @@ package dictionary
 import (
 	"fmt"
 	"io/ioutil"
+	"math/rand"
 	"strconv"
 	"strings"
 	"sync"
 )
 
 // NOTE: this package is a fork of sorts of https://github.com/icrowley/fake
-var samplesLock sync.Mutex
-var samplesCache = make(samplesTree)
-var lang = "en"
-var useExternalData = false
-var enFallback = true
+
+// the embedded dictionaries never change, so every Dictionary shares their samples
+var builtinLock sync.Mutex
+var builtinSamples = make(samplesTree)
 var availLangs = GetLangs()
-var customDataLocation = ""
 
-func ValueFromDictionary(cat string) string {
-	s := tryLookup(cat)
+/**
+ * Looks up values for dict() fields, first among the custom dictionaries in a
+ * directory and then among the embedded ones. Each Dictionary keeps its own
+ * settings and custom samples, so several may be used at once (e.g. by
+ * interpreters loading specs with different dictionary paths).
+ */
+type Dictionary struct {
+	lang               string
+	customDataLocation string
+	enFallback         bool
+	builtinOnly        bool // never look for custom dictionaries, not even in the working directory
+
+	lock          sync.Mutex
+	customSamples samplesTree // nil samples mark custom dictionaries that don't exist
+}
+
+// custom dictionaries are read from customDataLocation, or the working directory when it is empty
+func New(customDataLocation string) *Dictionary {
+	return &Dictionary{
+		lang:               "en",
+		customDataLocation: customDataLocation,
+		enFallback:         true,
+		customSamples:      make(samplesTree),
+	}
+}
+
+// only the embedded dictionaries are used; nothing is read from disk
+func Builtin() *Dictionary {
+	d := New("")
+	d.builtinOnly = true
+	return d
+}
+
+func (d *Dictionary) ValueFromDictionary(cat string) string {
+	return d.Value(cat, r)
+}
+
+// like ValueFromDictionary(), but draws from rng, which must not be shared between goroutines
+func (d *Dictionary) Value(cat string, rng *rand.Rand) string {
+	s := d.tryLookup(cat, rng)
 	if s == "" {
-		s = formatLookup(lang, cat, true)
+		s = d.formatLookup(cat, rng)
 	}
 	return s
 }
 
-func tryLookup(cat string) string {
-	useExternalData = true
-	s := lookup(lang, cat, true)
-	useExternalData = false
+func (d *Dictionary) tryLookup(cat string, rng *rand.Rand) string {
+	s := d.lookup(true, d.lang, cat, true, rng)
 	if s == "" {
-		s = lookup(lang, cat, true)
+		s = d.lookup(false, d.lang, cat, true, rng)
 	}
 	return s
 }
 
-func formatLookup(lang, cat string, fallback bool) string {
-	format := tryLookup(cat + "_format")
-	return valueFromFormat(format)
+func (d *Dictionary) formatLookup(cat string, rng *rand.Rand) string {
+	format := d.tryLookup(cat+"_format", rng)
+	return d.valueFromFormat(format, rng)
 }
 
 //TODO: optimize this formats processing because it's slow
-func valueFromFormat(format string) string {
+func (d *Dictionary) valueFromFormat(format string, rng *rand.Rand) string {
 	var result string
 	for _, ref := range strings.Split(format, "|") {
 		if strings.Contains(ref, "#") {
-			result += numericFormat(ref)
+			result += numericFormat(ref, rng)
 		} else if ref == " " {
 			result += " "
 		} else {
-			result += compositeFormat(ref)
+			result += d.compositeFormat(ref, rng)
 		}
 	}
 	return result
 }
 
-func compositeFormat(ref string) string {
+func (d *Dictionary) compositeFormat(ref string, rng *rand.Rand) string {
 	var result string
-	r := tryLookup(ref)
+	r := d.tryLookup(ref, rng)
 	if r == "" {
 		result += string(ref)
 	} else if strings.HasSuffix(ref, "_format") {
-		result += valueFromFormat(r)
+		result += d.valueFromFormat(r, rng)
 	} else {
 		result += string(r)
 	}
 	return result
 }
 
-func numericFormat(format string) string {
+func numericFormat(format string, rng *rand.Rand) string {
 	var result string
 	for _, ru := range format {
 		if ru == '#' {
-			result += strconv.Itoa(r.Intn(10))
+			result += strconv.Itoa(rng.Intn(10))
 		}
 	}
 	return result
 }
 
-func lookup(lang, cat string, fallback bool) string {
-	samplesLock.Lock()
-	s := _lookup(lang, cat, fallback)
-	samplesLock.Unlock()
-	return s
+// external chooses between custom and embedded dictionaries
+func (d *Dictionary) lookup(external bool, lang, cat string, fallback bool, rng *rand.Rand) string {
+	samples, err := d.samples(external, lang, cat)
+	if err != nil {
+		if lang != "en" && fallback && d.enFallback && err.Error() == ErrNoSamplesFn(lang).Error() {
+			return d.lookup(external, "en", cat, false, rng)
+		}
+		return ""
+	}
+	return samples[rng.Intn(len(samples))]
 }
 
-func _lookup(lang, cat string, fallback bool) string {
-	var samples []string
+func (d *Dictionary) samples(external bool, lang, cat string) ([]string, error) {
+	if !external {
+		builtinLock.Lock()
+		defer builtinLock.Unlock()
+		return populateSamples(builtinSamples, lang, cat, func() ([]byte, error) { return d.readFile(false, lang, cat) })
+	}
 
-	if samplesCache.hasKeyPath(lang, cat) {
-		samples = samplesCache[lang][cat]
-	} else {
-		var err error
-		samples, err = populateSamples(lang, cat)
-		if err != nil {
-			if lang != "en" && fallback && enFallback && err.Error() == ErrNoSamplesFn(lang).Error() {
-				return _lookup("en", cat, false)
-			}
-			return ""
-		}
+	if d.builtinOnly {
+		return nil, ErrNoSamplesFn(lang)
 	}
-	return samples[r.Intn(len(samples))]
-}
 
-func populateSamples(lang, cat string) ([]string, error) {
-	data, err := readFile(lang, cat)
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if d.customSamples.hasKeyPath(lang, cat) && nil == d.customSamples[lang][cat] {
+		return nil, ErrNoSamplesFn(lang)
+	}
+
+	samples, err := populateSamples(d.customSamples, lang, cat, func() ([]byte, error) { return d.readFile(true, lang, cat) })
 	if err != nil {
-		return nil, err
+		d.customSamples[lang][cat] = nil // don't look for the file again on every value
+	}
+	return samples, err
+}
+
+func populateSamples(cache samplesTree, lang, cat string, read func() ([]byte, error)) ([]string, error) {
+	if cache.hasKeyPath(lang, cat) {
+		return cache[lang][cat], nil
 	}
 
-	if _, ok := samplesCache[lang]; !ok {
-		samplesCache[lang] = make(map[string][]string)
+	if _, ok := cache[lang]; !ok {
+		cache[lang] = make(map[string][]string)
+	}
+
+	data, err := read()
+	if err != nil {
+		return nil, err
 	}
 
 	samples := strings.Split(strings.TrimSpace(string(data)), "\n")
 
-	samplesCache[lang][cat] = samples
+	cache[lang][cat] = samples
 	return samples, nil
 }
 
-func readFile(lang, cat string) ([]byte, error) {
-	fullpath := fullPath(lang, cat)
-	file, err := FS(useExternalData).Open(fullpath)
+func (d *Dictionary) readFile(external bool, lang, cat string) ([]byte, error) {
+	fullpath := d.fullPath(external, lang, cat)
+	file, err := FS(external).Open(fullpath)
 	if err != nil {
 		return nil, ErrNoSamplesFn(lang)
 	}
@@ -130,28 +181,20 @@ func readFile(lang, cat string) ([]byte, error) {
 	return ioutil.ReadAll(file)
 }
 
-func fullPath(lang, cat string) string {
+func (d *Dictionary) fullPath(external bool, lang, cat string) string {
 	fullpath := fmt.Sprintf("/data/%s/%s", lang, cat)
-	if useExternalData {
-		if customDataLocation == "" {
+	if external {
+		if d.customDataLocation == "" {
 			fullpath = cat
 		} else {
-			fullpath = fmt.Sprintf("%s/%s", customDataLocation, cat)
+			fullpath = fmt.Sprintf("%s/%s", d.customDataLocation, cat)
 		}
 	}
 	return fullpath
 }
 
-func SetCustomDataLocation(location string) {
-	customDataLocation = location
-}
-
-func UseExternalData(flag bool) {
-	useExternalData = flag
-}
-
-func EnFallback(flag bool) {
-	enFallback = flag
+func (d *Dictionary) EnFallback(flag bool) {
+	d.enFallback = flag
 }
 
 func GetLangs() []string {
@@ -164,7 +207,7 @@ func GetLangs() []string {
 	return langs
 }
 
-func SetLang(newLang string) error {
+func (d *Dictionary) SetLang(newLang string) error {
 	found := false
 	for _, l := range availLangs {
 		if newLang == l {
@@ -175,6 +218,6 @@ func SetLang(newLang string) error {
 	if !found {
 		return ErrNoLanguageFn(newLang)
 	}
-	lang = newLang
+	d.lang = newLang
 	return nil
 }
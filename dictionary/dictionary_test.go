@@ -7,46 +7,44 @@ import (
 )
 
 func TestSetLang(t *testing.T) {
-	err := SetLang("en")
+	err := New("").SetLang("en")
 	if err != nil {
 		t.Error("SetLang should successfully set lang")
 	}
 }
 
 func TestFakerFullPath(t *testing.T) {
+	d := New("")
 	expected := "/data/en/cat"
-	actual := fullPath("en", "cat")
+	actual := d.fullPath(false, "en", "cat")
 	if actual != expected {
 		t.Errorf("Expected %v but got %v", expected, actual)
 	}
-	UseExternalData(true)
 	expected = "cat"
-	actual = fullPath("en", "cat")
+	actual = d.fullPath(true, "en", "cat")
 	if actual != expected {
 		t.Errorf("Expected %v but got %v", expected, actual)
 	}
 
-	SetCustomDataLocation("/custom/path")
 	expected = "/custom/path/kitty"
-	actual = fullPath("en", "kitty")
+	actual = New("/custom/path").fullPath(true, "en", "kitty")
 	if actual != expected {
 		t.Errorf("Expected %v but got %v", expected, actual)
 	}
-	SetCustomDataLocation("")
-	UseExternalData(false)
 }
 
 func TestFakerRuWithCallback(t *testing.T) {
-	SetLang("en")
-	EnFallback(true)
-	brand := lookup(lang, "companies", true)
+	d := New("")
+	d.SetLang("en")
+	d.EnFallback(true)
+	brand := d.lookup(false, d.lang, "companies", true, r)
 	if brand == "" {
 		t.Error("Fake call for name with no samples with callback should not return blank string")
 	}
 }
 
 func TestCompositeFormat(t *testing.T) {
-	result := compositeFormat("first_names| |last_names")
+	result := New("").compositeFormat("first_names| |last_names", r)
 	if result == "" {
 		t.Error("Expected to get results, but got nothing :(")
 	}
@@ -64,7 +62,7 @@ func TestCompositeFormat(t *testing.T) {
 }
 
 func TestValueFromFormatShouldProcessSubFormats(t *testing.T) {
-	result := valueFromFormat("first_names| |full_names_format")
+	result := New("").valueFromFormat("first_names| |full_names_format", r)
 	if result == "" {
 		t.Error("Expected to get results, but got nothing :(")
 	}
@@ -83,7 +81,7 @@ func TestValueFromFormatShouldProcessSubFormats(t *testing.T) {
 }
 
 func TestCompositeFormatWithSubFormatCompositeComponents(t *testing.T) {
-	result := valueFromFormat("email_address_format| |phone_numbers_format")
+	result := New("").valueFromFormat("email_address_format| |phone_numbers_format", r)
 	if result == "" {
 		t.Error("Expected to get results, but got nothing :(")
 	}
@@ -111,7 +109,7 @@ func TestCompositeFormatWithSubFormatCompositeComponents(t *testing.T) {
 }
 
 func TestvalueFromFormat(t *testing.T) {
-	result := valueFromFormat("###")
+	result := New("").valueFromFormat("###", r)
 	if result == "" {
 		t.Error("Expected to get results, but got nothing :(")
 	}
@@ -122,7 +120,7 @@ func TestvalueFromFormat(t *testing.T) {
 }
 
 func TestvalueFromFormatWithCompositeComponents(t *testing.T) {
-	result := valueFromFormat("first_names| |###")
+	result := New("").valueFromFormat("first_names| |###", r)
 	if result == "" {
 		t.Error("Expected to get results, but got nothing :(")
 	}
@@ -143,7 +141,7 @@ func TestvalueFromFormatWithCompositeComponents(t *testing.T) {
 }
 
 func TestValueFromDictionaryShouldTakeFormatWithoutFormatSuffix(t *testing.T) {
-	result := ValueFromDictionary("full_names")
+	result := New("").ValueFromDictionary("full_names")
 	if result == "" {
 		t.Error("Expected to get results, but got nothing :(")
 	}
@@ -164,19 +162,20 @@ func TestValueFromDictionaryShouldTakeFormatWithoutFormatSuffix(t *testing.T) {
 // This test should be run with the race detector enabled.
 func TestConcurrentSafety(t *testing.T) {
 	workerCount := 10
+	d := New("")
 	doneChan := make(chan struct{})
 
 	for i := 0; i < workerCount; i++ {
 		go func() {
 			for j := 0; j < 1000; j++ {
-				lookup(lang, "first_names", true)
-				lookup(lang, "last_names", true)
-				lookup(lang, "genders", true)
-				ValueFromDictionary("full_names")
-				ValueFromDictionary("email_address")
-				ValueFromDictionary("email_address")
-				lookup(lang, "companies", true)
-				lookup(lang, "companies", true)
+				d.lookup(false, d.lang, "first_names", true, r)
+				d.lookup(false, d.lang, "last_names", true, r)
+				d.lookup(false, d.lang, "genders", true, r)
+				d.ValueFromDictionary("full_names")
+				d.ValueFromDictionary("email_address")
+				d.ValueFromDictionary("email_address")
+				d.lookup(false, d.lang, "companies", true, r)
+				d.lookup(true, d.lang, "companies", true, r)
 			}
 			doneChan <- struct{}{}
 		}()
@@ -186,3 +185,114 @@ func TestConcurrentSafety(t *testing.T) {
 		<-doneChan
 	}
 }
+
+func TestValidateCategoryAcceptsDictionariesAndFormats(t *testing.T) {
+	for _, cat := range []string{"first_names", "full_names", "full_names_format", "email_address", "phone_numbers"} {
+		if err := New("").ValidateCategory(cat); err != nil {
+			t.Errorf("Expected %q to be a valid category, but got error: %v", cat, err)
+		}
+	}
+}
+
+func TestValidateCategoryRejectsUnknownCategories(t *testing.T) {
+	err := New("").ValidateCategory("first_name")
+	if err == nil || err.Error() != `Unknown dictionary "first_name"` {
+		t.Errorf("Expected an unknown dictionary error, but got: %v", err)
+	}
+}
+
+func TestValidateCategoryRejectsBrokenFormatReferences(t *testing.T) {
+	d := New("testdata")
+
+	if err := d.ValidateCategory("custom_composite"); err != nil {
+		t.Errorf("Expected custom format to be valid, but got error: %v", err)
+	}
+
+	err := d.ValidateCategory("broken_composite")
+	if err == nil || err.Error() != `Format "broken_composite_format" refers to unknown dictionary "last_nam"` {
+		t.Errorf("Expected a broken format reference error, but got: %v", err)
+	}
+}
+
+func TestCatalogListsBuiltinAndCustomDictionaries(t *testing.T) {
+	entries, err := New("testdata/problems").Catalog()
+	if err != nil {
+		t.Fatalf("Didn't expect to get an error: %v", err)
+	}
+
+	found := make(map[string]Entry)
+	for _, entry := range entries {
+		found[entry.Source+":"+entry.Name] = entry
+	}
+
+	if e := found["builtin:first_names"]; e.Count == 0 || e.Format || e.Shadowed {
+		t.Errorf("Expected builtin first_names dictionary with entries, but got %v", e)
+	}
+
+	if e := found["builtin:full_names_format"]; !e.Format {
+		t.Errorf("Expected full_names_format to be a format, but got %v", e)
+	}
+
+	if e := found["builtin:colors"]; !e.Shadowed {
+		t.Errorf("Expected builtin colors dictionary to be overridden by custom dictionary, but got %v", e)
+	}
+
+	if e := found["custom:colors"]; e.Count != 4 || e.Shadowed {
+		t.Errorf("Expected custom colors dictionary with 4 entries, but got %v", e)
+	}
+}
+
+func TestSampleReturnsRequestedNumberOfValues(t *testing.T) {
+	values, err := New("").Sample("full_names_format", 3)
+	if err != nil {
+		t.Fatalf("Didn't expect to get an error: %v", err)
+	}
+
+	if len(values) != 3 {
+		t.Errorf("Expected 3 values, but got %v", values)
+	}
+
+	for _, v := range values {
+		if len(strings.Split(v, " ")) != 2 {
+			t.Errorf("Expected format to be expanded, but got %q", v)
+		}
+	}
+}
+
+func TestValidateDirectoryReportsProblems(t *testing.T) {
+	problems, err := ValidateDirectory("testdata/problems")
+	if err != nil {
+		t.Fatalf("Didn't expect to get an error: %v", err)
+	}
+
+	expected := []string{
+		"testdata/problems/colors:2: empty entry",
+		`testdata/problems/colors:4: duplicate entry "red" (first seen on line 1)`,
+		`testdata/problems/paint_format: Format "paint_format" refers to unknown dictionary "nope_names"`,
+	}
+
+	if len(problems) != len(expected) {
+		t.Fatalf("Expected %d problems, but got %v", len(expected), problems)
+	}
+
+	for i, msg := range expected {
+		if problems[i].Error() != msg {
+			t.Errorf("Expected problem [%s], but got [%v]", msg, problems[i])
+		}
+	}
+}
+
+func TestFallbacksReportBlankCustomEntries(t *testing.T) {
+	d := New("testdata/problems")
+
+	fallbacks := d.Fallbacks("colors")
+	expected := `1 of 4 entries in custom dictionary "colors" are blank; those values will come from the builtin "colors" dictionary instead`
+
+	if len(fallbacks) != 1 || fallbacks[0] != expected {
+		t.Errorf("Expected [%s], but got %v", expected, fallbacks)
+	}
+
+	if fallbacks := d.Fallbacks("first_names"); len(fallbacks) != 0 {
+		t.Errorf("Expected no fallbacks for a builtin dictionary, but got %v", fallbacks)
+	}
+}
@@ -7,4 +7,10 @@ var (
 	ErrNoLanguageFn = func(lang string) error { return fmt.Errorf("The language passed (%s) is not available", lang) }
 	// ErrNoSamplesFn is the error that indicates that there are no samples for the given language
 	ErrNoSamplesFn = func(lang string) error { return fmt.Errorf("No samples found for language: %s", lang) }
+	// ErrUnknownCategoryFn is the error that indicates that a category resolves to neither a dictionary nor a format
+	ErrUnknownCategoryFn = func(cat string) error { return fmt.Errorf("Unknown dictionary %q", cat) }
+	// ErrBrokenFormatRefFn is the error that indicates that a format refers to a dictionary that does not exist
+	ErrBrokenFormatRefFn = func(format, ref string) error {
+		return fmt.Errorf("Format %q refers to unknown dictionary %q", format, ref)
+	}
 )
@@ -0,0 +1,124 @@
+package dictionary
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// format components that look like this are treated as dictionary references;
+// anything else (punctuation, whitespace) is emitted verbatim by valueFromFormat()
+var referencePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ValidateCategory ensures that a category resolves to a dictionary, either
+// directly or through its `_format` counterpart, and that every dictionary
+// referenced by that format resolves as well.
+func (d *Dictionary) ValidateCategory(cat string) error {
+	if d.hasSamples(cat) {
+		if strings.HasSuffix(cat, "_format") {
+			return d.validateFormat(cat, map[string]bool{})
+		}
+		return nil
+	}
+
+	if format := cat + "_format"; d.hasSamples(format) {
+		return d.validateFormat(format, map[string]bool{})
+	}
+
+	return ErrUnknownCategoryFn(cat)
+}
+
+func (d *Dictionary) validateFormat(format string, seen map[string]bool) error {
+	if seen[format] {
+		return nil
+	}
+	seen[format] = true
+
+	samples, err := d.samplesFor(format)
+	if err != nil {
+		return ErrUnknownCategoryFn(format)
+	}
+
+	for _, line := range samples {
+		for _, ref := range strings.Split(line, "|") {
+			if strings.Contains(ref, "#") || !referencePattern.MatchString(ref) {
+				continue
+			}
+
+			if !d.hasSamples(ref) {
+				return ErrBrokenFormatRefFn(format, ref)
+			}
+
+			if strings.HasSuffix(ref, "_format") {
+				if err := d.validateFormat(ref, seen); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func (d *Dictionary) hasSamples(cat string) bool {
+	_, err := d.samplesFor(cat)
+	return err == nil
+}
+
+// looks up samples the same way tryLookup() does: custom dictionaries
+// first, then the embedded ones
+func (d *Dictionary) samplesFor(cat string) ([]string, error) {
+	if samples, err := d.samples(true, d.lang, cat); err == nil {
+		return samples, nil
+	}
+
+	return d.samples(false, d.lang, cat)
+}
+
+/**
+ * Fallbacks describes the ways in which values for a category would silently
+ * come from somewhere other than the dictionary it names: blank entries in a
+ * custom dictionary fall through to the builtin data (see tryLookup()), and
+ * categories missing from the current language fall back to English.
+ */
+func (d *Dictionary) Fallbacks(cat string) []string {
+	result := make([]string, 0)
+
+	custom, customErr := d.readFile(true, d.lang, cat)
+
+	if customErr == nil {
+		entries := strings.Split(strings.TrimSpace(string(custom)), "\n")
+		blanks := 0
+
+		for _, entry := range entries {
+			if strings.TrimSpace(entry) == "" {
+				blanks++
+			}
+		}
+
+		if blanks > 0 {
+			result = append(result, fmt.Sprintf("%d of %d entries in custom dictionary %q are blank; %s", blanks, len(entries), cat, d.blankValuesFrom(cat)))
+		}
+	} else if _, err := d.readFile(false, d.lang, cat); err != nil && d.lang != "en" && d.enFallback {
+		if _, err := d.readFile(false, "en", cat); err == nil {
+			result = append(result, fmt.Sprintf("There is no %q dictionary for language %q, so its values will be in English", cat, d.lang))
+		}
+	}
+
+	return result
+}
+
+// where ValueFromDictionary() turns when a custom dictionary yields a blank value
+func (d *Dictionary) blankValuesFrom(cat string) string {
+	if _, err := d.readFile(false, d.lang, cat); err == nil {
+		return fmt.Sprintf("those values will come from the builtin %q dictionary instead", cat)
+	}
+
+	for _, external := range []bool{true, false} {
+		if _, err := d.readFile(external, d.lang, cat+"_format"); err == nil {
+			return fmt.Sprintf("those values will come from the %q format instead", cat+"_format")
+		}
+	}
+
+	return "those values will be empty"
+}
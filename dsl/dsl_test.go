@@ -60,7 +60,7 @@ func testRootNode(kids NodeSet) Node {
 
 func tableSpecForReservedWords() map[string]string {
 	result := make(map[string]string)
-	keyWords := []string{"date", "decimal", "dict", "false", "generate", "integer", "string"}
+	keyWords := []string{"date", "decimal", "dict", "false", "generate", "integer", "let", "pick", "string"}
 	for _, kw := range keyWords {
 		result[fmt.Sprintf(`%s:`, kw)] = fmt.Sprintf(`Illegal identifier: %q is a reserved word`, kw)
 		result[fmt.Sprintf(`t: { %s string }`, kw)] = fmt.Sprintf(`Illegal identifier: %q is a reserved word`, kw)
@@ -104,6 +104,89 @@ func TestParsesChildEntity(t *testing.T) {
 	AssertEqual(t, testRoot.String(), actual.(Node).String())
 }
 
+func TestParsesEntityWithSeveralParents(t *testing.T) {
+	entity := testEntity("Post", NodeSet{})
+	entity.Related = &Node{Kind: "identifier", Value: "Content"}
+	entity.Mixins = NodeSet{testIdNode("Timestamps"), testIdNode("Auditable")}
+	testRoot := testRootNode(NodeSet{entity})
+	actual, err := runParser("Post: Content + Timestamps+Auditable { }")
+	AssertNil(t, err, "Didn't expect to get an error: %v", err)
+	AssertEqual(t, testRoot.String(), actual.(Node).String())
+}
+
+func TestParsesExcludedAndHiddenFields(t *testing.T) {
+	salt := testEntityField("salt", Node{Kind: "builtin", Value: "string"}, NodeSet{}, nil)
+	salt.Hidden = true
+	hidden := testEntityField("hidden", Node{Kind: "literal-bool", Value: true}, nil, nil)
+	named := testEntityField("hidden", Node{Kind: "builtin", Value: "integer"}, NodeSet{}, nil)
+	password := Node{Kind: "exclusion", Name: "password"}
+
+	entity := testEntity("PublicUser", NodeSet{salt, hidden, named, password})
+	entity.Related = &Node{Kind: "identifier", Value: "User"}
+	testRoot := testRootNode(NodeSet{entity})
+	actual, err := runParser("PublicUser: User { hidden salt string, hidden true, hidden integer, - password }")
+	AssertNil(t, err, "Didn't expect to get an error: %v", err)
+	AssertEqual(t, testRoot.String(), actual.(Node).String())
+}
+
+func TestParsesAbstractEntities(t *testing.T) {
+	mammal := testEntity("Mammal", NodeSet{})
+	mammal.Abstract = true
+	named := testEntity("abstract", NodeSet{})
+	testRoot := testRootNode(NodeSet{mammal, named})
+	actual, err := runParser("abstract Mammal: {}\nabstract: {}")
+	AssertNil(t, err, "Didn't expect to get an error: %v", err)
+	AssertEqual(t, testRoot.String(), actual.(Node).String())
+
+	AssertEqual(t, "Mammal: {}", actual.(Node).Children[0].Raw)
+	AssertEqual(t, 10, actual.(Node).Children[0].Ref.Col)
+}
+
+func TestParsesUnions(t *testing.T) {
+	card := Node{Kind: "alternative", Value: testIdNode("CreditCard"), Args: NodeSet{Node{Kind: "literal-int", Value: 3}}}
+	transfer := Node{Kind: "alternative", Value: testIdNode("BankTransfer")}
+	inline := Node{Kind: "alternative", Value: testEntity("", NodeSet{}), Args: NodeSet{testIdNode("W")}}
+	union := Node{Kind: "union", Children: NodeSet{card, transfer, inline}}
+
+	payment := testEntityField("payment", union, NodeSet{}, NodeSet{Node{Kind: "literal-int", Value: 2}})
+	order := testEntity("Order", NodeSet{payment})
+	generation := testGenEntity(union, NodeSet{Node{Kind: "literal-int", Value: 1}})
+
+	actual, err := runParser("Order: { payment CreditCard * 3 | BankTransfer|{} *W [2] }\ngenerate (1, CreditCard*3 | BankTransfer | {} * W)")
+	AssertNil(t, err, "Didn't expect to get an error: %v", err)
+	AssertEqual(t, testRootNode(NodeSet{order, generation}).String(), actual.(Node).String())
+}
+
+func TestParsesArrayAndObjectLiterals(t *testing.T) {
+	actual, err := runParser(`Thing: {
+  tags   ["a", [1, 2.5], null,],
+  none   [ ],
+  config {"depth": 2, "nested": {"on": true}},
+  pet    {}
+}`)
+	AssertNil(t, err, "Didn't expect to get an error: %v", err)
+
+	fields := actual.(Node).Children[0].Children
+	AssertEqual(t, "literal-array", fields[0].ValNode().Kind)
+	AssertEqual(t, "[a [1 2.5] <nil>]", fmt.Sprintf("%v", fields[0].ValNode().Value))
+	AssertEqual(t, 3, len(fields[0].ValNode().Children))
+	AssertEqual(t, "[]", fmt.Sprintf("%v", fields[1].ValNode().Value))
+	AssertEqual(t, "literal-object", fields[2].ValNode().Kind)
+	AssertEqual(t, "map[depth:2 nested:map[on:true]]", fmt.Sprintf("%v", fields[2].ValNode().Value))
+	AssertEqual(t, "entity", fields[3].ValNode().Kind, "Expected {} to still be an empty entity")
+}
+
+func TestParsesStructs(t *testing.T) {
+	street := testEntityField("street", Node{Kind: "builtin", Value: "string"}, NodeSet{Node{Kind: "literal-int", Value: 10}}, nil)
+	address := testEntityField("address", Node{Kind: "struct", Children: NodeSet{street}}, NodeSet{}, nil)
+	money := testEntityField("money", Node{Kind: "struct", Children: NodeSet{}}, NodeSet{}, NodeSet{Node{Kind: "literal-int", Value: 2}})
+	other := testEntityField("other", testIdNode("struct"), NodeSet{}, nil)
+
+	actual, err := runParser("Person: { address struct { street string(10) }, money struct{}[2], other struct }")
+	AssertNil(t, err, "Didn't expect to get an error: %v", err)
+	AssertEqual(t, testRootNode(NodeSet{testEntity("Person", NodeSet{address, money, other})}).String(), actual.(Node).String())
+}
+
 func TestParsesBasicGenerationStatement(t *testing.T) {
 	args := NodeSet{Node{Kind: "literal-int", Value: 1}}
 	genBird := testGenEntity(testIdNode("Bird"), args)
@@ -295,6 +378,79 @@ func TestParseEntityWithEntityReferenceFieldWithoutArgs(t *testing.T) {
 	AssertEqual(t, testRoot.String(), actual.(Node).String())
 }
 
+func TestParsesLetStatements(t *testing.T) {
+	actual, err := runParser("let ADULT = 18\nlet AGES = (ADULT, 65)\nlet NAMES = dict(\"first_names\")")
+	AssertNil(t, err, "Didn't expect to get an error: %v", err)
+
+	statements := actual.(Node).Children
+	AssertEqual(t, 3, len(statements))
+
+	AssertEqual(t, Node{Kind: "let", Name: "ADULT", Value: Node{Kind: "literal-int", Value: 18}}.String(), statements[0].String())
+	AssertEqual(t, Node{Kind: "let", Name: "AGES", Value: Node{Kind: "range", Args: NodeSet{testIdNode("ADULT"), Node{Kind: "literal-int", Value: 65}}}}.String(), statements[1].String())
+	AssertEqual(t, Node{Kind: "let", Name: "NAMES", Value: Node{Kind: "builtin", Value: "dict", Args: NodeSet{Node{Kind: "literal-string", Value: "first_names"}}}}.String(), statements[2].String())
+
+	AssertEqual(t, 2, statements[1].Ref.Line)
+	AssertEqual(t, 5, statements[1].Ref.Col)
+}
+
+func TestGenerateCountMayBeAnIdentifier(t *testing.T) {
+	actual, err := runParser("generate(USERS, User)")
+	AssertNil(t, err, "Didn't expect to get an error: %v", err)
+	AssertEqual(t, testRootNode(NodeSet{testGenEntity(testIdNode("User"), NodeSet{testIdNode("USERS")})}).String(), actual.(Node).String())
+}
+
+func TestLetRequiresAValue(t *testing.T) {
+	_, err := runParser("let ADULT =\nPerson: {}")
+	ExpectsError(t, "`let` statement \"let ADULT =\" requires a name and a value, e.g. `let ADULT_AGE = 18`", removeLocationInfo(err))
+}
+
+func TestIdentifiersMayStartWithReservedWords(t *testing.T) {
+	field := testEntityField("letter", Node{Kind: "literal-string", Value: "a"}, nil, nil)
+	dated := testEntityField("dated", Node{Kind: "builtin", Value: "date"}, NodeSet{}, nil)
+	expected := testRootNode(NodeSet{testEntity("lettered", NodeSet{field, dated})})
+
+	actual, err := runParser(`lettered: { letter "a", dated date }`)
+	AssertNil(t, err, "Didn't expect to get an error: %v", err)
+	AssertEqual(t, expected.String(), actual.(Node).String())
+}
+
+func TestParsesTemplatesAndTheirInstances(t *testing.T) {
+	actual, err := runParser(`Product(minPrice decimal, tier): { price decimal(minPrice, 9.0) }
+Gift: Product(1.0, "gift") {}
+generate (1, Product(2.0, TIER))`)
+	AssertNil(t, err, "Didn't expect to get an error: %v", err)
+
+	statements := actual.(Node).Children
+	AssertEqual(t, 3, len(statements))
+
+	price := testEntityField("price", Node{Kind: "builtin", Value: "decimal"}, NodeSet{testIdNode("minPrice"), Node{Kind: "literal-float", Value: 9.0}}, nil)
+	template := Node{
+		Kind:  "template",
+		Name:  "Product",
+		Value: testEntity("", NodeSet{price}),
+		Args:  NodeSet{Node{Kind: "param", Name: "minPrice", Value: Node{Kind: "builtin", Value: "decimal"}}, Node{Kind: "param", Name: "tier"}},
+	}
+	AssertEqual(t, template.String(), statements[0].String())
+
+	parent := testIdNode("Product")
+	parent.Args = NodeSet{Node{Kind: "literal-float", Value: 1.0}, Node{Kind: "literal-string", Value: "gift"}}
+	AssertEqual(t, Node{Kind: "entity", Name: "Gift", Related: &parent, Children: NodeSet{}}.String(), statements[1].String())
+
+	instance := testIdNode("Product")
+	instance.Args = NodeSet{Node{Kind: "literal-float", Value: 2.0}, testIdNode("TIER")}
+	AssertEqual(t, testGenEntity(instance, NodeSet{Node{Kind: "literal-int", Value: 1}}).String(), statements[2].String())
+}
+
+func TestAnonymousExtensionsMayInstantiateTemplatesWithIdentifiers(t *testing.T) {
+	actual, err := runParser(`Product(low, high) { sale true }`)
+	AssertNil(t, err, "Didn't expect to get an error: %v", err)
+
+	parent := testIdNode("Product")
+	parent.Args = NodeSet{testIdNode("low"), testIdNode("high")}
+	sale := testEntityField("sale", Node{Kind: "literal-bool", Value: true}, nil, nil)
+	AssertEqual(t, testRootNode(NodeSet{Node{Kind: "entity", Related: &parent, Children: NodeSet{sale}}}).String(), actual.(Node).String())
+}
+
 func TestRequiresDefOrGenerateStatements(t *testing.T) {
 	_, err := runParser("eek")
 	expectedErrorMsg := `Don't know how to evaluate "eek"`
@@ -348,3 +504,24 @@ func TestIllegalIdentifiers(t *testing.T) {
 
 	}
 }
+
+func TestRecoversFromUnknownStatements(t *testing.T) {
+	actual, err := runParser("eek\n  more eek\nBird: { }\nwhat is this\ngenerate(1, Bird)")
+	expected := testRootNode(NodeSet{testEntity("Bird", NodeSet{}), testGenEntity(testIdNode("Bird"), NodeSet{Node{Kind: "literal-int", Value: 1}})})
+
+	AssertEqual(t, expected.String(), actual.(Node).String())
+
+	errors := ParseErrors("testScript", err)
+	AssertEqual(t, 2, len(errors))
+	AssertEqual(t, `testScript:1:1 [byte 0] Don't know how to evaluate "eek\n  more eek"`, errors[0].Error())
+	AssertEqual(t, `testScript:4:1 [byte 25] Don't know how to evaluate "what is this"`, errors[1].Error())
+}
+
+func TestParseErrorsHaveCodes(t *testing.T) {
+	_, err := runParser("Bird: { name }\ngenerate Bird")
+	errors := ParseErrors("testScript", err)
+
+	AssertEqual(t, 2, len(errors))
+	AssertEqual(t, CodeMissingFieldType, errors[0].(*Diagnostic).Code)
+	AssertEqual(t, CodeBadGenerate, errors[1].(*Diagnostic).Code)
+}
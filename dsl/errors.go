@@ -0,0 +1,211 @@
+package dsl
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Stable error codes; these are part of bobcat's user-facing output, so
+// never renumber or reuse them; only add new ones.
+const (
+	CodeUnknown = "E000"
+
+	// syntax errors
+	CodeSyntax                = "E100"
+	CodeBadImport             = "E101"
+	CodeUnterminatedEntity    = "E102"
+	CodeUndelimitedFields     = "E103"
+	CodeUnterminatedBound     = "E104"
+	CodeUnterminatedArguments = "E105"
+	CodeUndelimitedArguments  = "E106"
+	CodeIllegalIdentifier     = "E107"
+	CodeBadDate               = "E108"
+	CodeBadGenerate           = "E109"
+	CodeMissingFieldType      = "E110"
+	CodeMissingAssignment     = "E111"
+	CodeOctal                 = "E112"
+	CodeBadLet                = "E113"
+
+	// semantic errors
+	CodeUnresolvedSymbol  = "E200"
+	CodeTypeMismatch      = "E201"
+	CodeInvalidArguments  = "E202"
+	CodeInvalidRange      = "E203"
+	CodeUnknownDictionary = "E204"
+	CodeImportFailed      = "E205"
+	CodeInvalidGenerate   = "E206"
+	CodeInvalidField      = "E207"
+
+	// warnings, reported by `bobcat lint`
+	CodeUnusedEntity       = "W300"
+	CodeShadowedEntity     = "W301"
+	CodeOverriddenType     = "W302"
+	CodeEndlessNesting     = "W303"
+	CodeHugeBound          = "W304"
+	CodeDictionaryFallback = "W305"
+	CodeDeprecated         = "W307"
+)
+
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// an error or warning, optionally tied to a location in a spec file
+type Diagnostic struct {
+	Ref      *Location
+	Severity string
+	Code     string
+	Msg      string
+}
+
+func NewError(code, msg string, tokens ...interface{}) *Diagnostic {
+	return &Diagnostic{Severity: SeverityError, Code: code, Msg: fmt.Sprintf(msg, tokens...)}
+}
+
+func NewWarning(code, msg string, tokens ...interface{}) *Diagnostic {
+	return &Diagnostic{Severity: SeverityWarning, Code: code, Msg: fmt.Sprintf(msg, tokens...)}
+}
+
+func (e *Diagnostic) Error() string {
+	if nil == e.Ref {
+		return e.Msg
+	}
+	return fmt.Sprintf("%v %s", e.Ref, e.Msg)
+}
+
+// the location fields are flattened so that tools don't need to understand bobcat's types
+func (e *Diagnostic) MarshalJSON() ([]byte, error) {
+	out := struct {
+		File     string `json:"file,omitempty"`
+		Line     int    `json:"line,omitempty"`
+		Column   int    `json:"column,omitempty"`
+		Offset   int    `json:"offset"`
+		Severity string `json:"severity"`
+		Code     string `json:"code"`
+		Message  string `json:"message"`
+	}{Offset: -1, Severity: e.Severity, Code: e.Code, Message: e.Msg}
+
+	if nil != e.Ref {
+		out.File, out.Line, out.Column, out.Offset = e.Ref.Filename, e.Ref.Line, e.Ref.Col, e.Ref.Offset
+	}
+
+	return json.Marshal(out)
+}
+
+// converts any error into a *Diagnostic, treating errors that aren't already
+// diagnostics as uncategorized, unlocated errors
+func AsDiagnostic(err error) *Diagnostic {
+	if d, ok := err.(*Diagnostic); ok {
+		return d
+	}
+	return &Diagnostic{Severity: SeverityError, Code: CodeUnknown, Msg: err.Error()}
+}
+
+// converts the errors produced by the generated parser into located *Diagnostic values
+func ParseErrors(filename string, err error) []error {
+	list, isList := err.(errList)
+
+	if !isList {
+		return []error{err}
+	}
+
+	result := make([]error, len(list))
+
+	for i, e := range list {
+		if pe, ok := e.(*parserError); ok {
+			located := &Diagnostic{Ref: NewLocation(filename, pe.pos.line, pe.pos.col, pe.pos.offset), Severity: SeverityError, Code: CodeSyntax, Msg: pe.Inner.Error()}
+
+			if inner, ok := pe.Inner.(*Diagnostic); ok {
+				located.Code, located.Msg = inner.Code, inner.Msg
+			}
+
+			result[i] = located
+		} else {
+			result[i] = e
+		}
+	}
+
+	sort.SliceStable(result, func(a, b int) bool {
+		return offsetOf(result[a]) < offsetOf(result[b])
+	})
+
+	return result
+}
+
+func offsetOf(err error) int {
+	if e, ok := err.(*Diagnostic); ok && nil != e.Ref {
+		return e.Ref.Offset
+	}
+	return -1
+}
+
+/**
+ * Formats an error for humans; located errors include the offending source line
+ * with a caret under the column where the problem was found:
+ *
+ * users.lang:4:3: error E203: max 20 cannot be less than min 50
+ *   4 |   age integer(50, 20),
+ *     |   ^
+ */
+func Render(err error) string {
+	e, ok := err.(*Diagnostic)
+
+	if !ok || nil == e.Ref {
+		return err.Error()
+	}
+
+	source, _ := ioutil.ReadFile(e.Ref.Filename)
+	return render(e, source)
+}
+
+// like Render(), but with the source of `filename` already in memory, e.g. for input that was never saved
+func RenderSource(err error, filename string, source []byte) string {
+	if e, ok := err.(*Diagnostic); ok && nil != e.Ref && e.Ref.Filename == filename {
+		return render(e, source)
+	}
+	return Render(err)
+}
+
+// the snippet is left out when the source can't be read
+func render(e *Diagnostic, source []byte) string {
+	ref := e.Ref
+	header := fmt.Sprintf("%s:%d:%d: %s %s: %s", ref.Filename, ref.Line, ref.Col, e.Severity, e.Code, e.Msg)
+
+	if nil == source || ref.Offset > len(source) {
+		return header
+	}
+
+	return header + "\n" + snippet(source, ref)
+}
+
+func snippet(source []byte, ref *Location) string {
+	start := strings.LastIndexByte(string(source[:ref.Offset]), '\n') + 1
+	end := strings.IndexByte(string(source[ref.Offset:]), '\n')
+
+	if end < 0 {
+		end = len(source)
+	} else {
+		end += ref.Offset
+	}
+
+	line := strings.TrimRight(string(source[start:end]), "\r")
+	gutter := fmt.Sprintf("%d", ref.Line)
+	blank := strings.Repeat(" ", len(gutter))
+
+	// preserve tabs so the caret lines up regardless of tab width
+	indent := make([]rune, 0, utf8.RuneCount(source[start:ref.Offset]))
+	for _, r := range string(source[start:ref.Offset]) {
+		if r == '\t' {
+			indent = append(indent, '\t')
+		} else {
+			indent = append(indent, ' ')
+		}
+	}
+
+	return fmt.Sprintf("  %s | %s\n  %s | %s^", gutter, line, blank, string(indent))
+}
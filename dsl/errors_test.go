@@ -0,0 +1,38 @@
+package dsl
+
+import (
+	"fmt"
+	. "github.com/ThoughtWorksStudios/bobcat/test_helpers"
+	"testing"
+)
+
+func TestSnippetPointsAtColumn(t *testing.T) {
+	source := []byte("Bird: {\n\tage integer(10, 1)\n}")
+	expected := "  2 | \tage integer(10, 1)\n    | \t    ^"
+
+	AssertEqual(t, expected, snippet(source, NewLocation("eek", 2, 6, 13)))
+}
+
+func TestRenderWithoutLocation(t *testing.T) {
+	AssertEqual(t, "nope", Render(NewError(CodeSyntax, "nope")))
+}
+
+func TestRenderWithUnreadableSource(t *testing.T) {
+	err := &Diagnostic{Ref: NewLocation("does/not/exist.lang", 2, 6, 13), Severity: SeverityError, Code: CodeInvalidRange, Msg: "nope"}
+	AssertEqual(t, "does/not/exist.lang:2:6: error E203: nope", Render(err))
+}
+
+func TestDiagnosticJSON(t *testing.T) {
+	located, _ := (&Diagnostic{Ref: NewLocation("eek.lang", 2, 6, 13), Severity: SeverityError, Code: CodeInvalidRange, Msg: "nope"}).MarshalJSON()
+	AssertEqual(t, `{"file":"eek.lang","line":2,"column":6,"offset":13,"severity":"error","code":"E203","message":"nope"}`, string(located))
+
+	unlocated, _ := NewWarning(CodeUnknown, "hmm").MarshalJSON()
+	AssertEqual(t, `{"offset":-1,"severity":"warning","code":"E000","message":"hmm"}`, string(unlocated))
+}
+
+func TestAsDiagnostic(t *testing.T) {
+	d := AsDiagnostic(fmt.Errorf("plain"))
+	AssertEqual(t, CodeUnknown, d.Code)
+	AssertEqual(t, SeverityError, d.Severity)
+	AssertEqual(t, "plain", d.Msg)
+}
@@ -0,0 +1,408 @@
+package dsl
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const formatIndent = "  "
+
+/**
+ * Prints a spec in bobcat's canonical layout:
+ *
+ * - imports and generate statements are grouped, one per line, and entity
+ *   definitions are separated by blank lines; otherwise, at most one blank
+ *   line from the original is kept between statements and fields
+ * - fields are declared on their own lines, indented two spaces, with their
+ *   types aligned; inline entities that were written on one line stay that way
+ * - literals are printed exactly as written, and comments are kept in place
+ */
+func Format(filename string, source []byte) ([]byte, error) {
+	ast, err := Parse(filename, source, GlobalStore("filename", filename))
+	if err != nil {
+		return nil, err
+	}
+
+	root := ast.(Node)
+	p := &printer{source: source, comments: root.Comments}
+	p.root(root)
+
+	result := p.out.Bytes()
+
+	// formatting should only ever change whitespace, so refuse to produce anything else
+	if reparsed, err := Parse(filename, result, GlobalStore("filename", filename)); err != nil || !sameMeaning(root, reparsed.(Node)) {
+		return nil, fmt.Errorf("Cannot format %s without changing its meaning", filename)
+	}
+
+	return result, nil
+}
+
+func sameMeaning(a, b Node) bool {
+	if a.String() != b.String() || len(a.Comments) != len(b.Comments) {
+		return false
+	}
+
+	for i := range a.Comments {
+		if a.Comments[i].Value != b.Comments[i].Value {
+			return false
+		}
+	}
+
+	return true
+}
+
+type printer struct {
+	source   []byte
+	comments NodeSet // those not yet printed, in source order
+	out      bytes.Buffer
+}
+
+func (p *printer) root(root Node) {
+	for idx, statement := range root.Children {
+		start := p.statementStart(statement)
+
+		if idx > 0 {
+			prev := root.Children[idx-1]
+			p.endLine(start)
+
+			if statement.Kind != prev.Kind || statement.Kind == "entity" || statement.Kind == "template" || p.blankLineBefore(p.nextOffset(start)) {
+				p.blankLine()
+			}
+		}
+
+		p.commentLines(start, "")
+		p.statement(statement)
+	}
+
+	if len(root.Children) > 0 {
+		p.endLine(len(p.source) + 1)
+	}
+
+	p.commentLines(len(p.source)+1, "")
+	p.trimBlankLine()
+}
+
+func (p *printer) statement(node Node) {
+	switch node.Kind {
+	case "import":
+		p.write("import " + p.literal(node))
+	case "generation":
+		p.write("generate (")
+		for _, arg := range node.Args {
+			p.write(p.literal(arg) + ", ")
+		}
+		p.entityRef(node.ValNode(), "")
+		p.write(")")
+	case "let":
+		p.write("let " + node.Name + " = ")
+		switch value := node.ValNode(); value.Kind {
+		case "range":
+			p.write("(" + p.list(value.Args) + ")")
+		case "builtin":
+			p.write(value.ValStr() + "(" + p.list(value.Args) + ")")
+		default:
+			p.write(p.literal(value))
+		}
+	case "template":
+		params := make([]string, len(node.Args))
+		for i, param := range node.Args {
+			params[i] = param.Name
+			if paramType, typed := param.Value.(Node); typed {
+				params[i] += " " + paramType.ValStr()
+			}
+		}
+
+		p.write(node.Name + "(" + strings.Join(params, ", ") + "): ")
+		p.entity(node.ValNode(), "", false)
+	case "entity":
+		p.entity(node, "", false)
+	default:
+		p.write(node.Raw)
+	}
+}
+
+func (p *printer) entityRef(node Node, indent string) {
+	switch node.Kind {
+	case "entity":
+		p.entity(node, indent, true)
+	case "union":
+		for i, alternative := range node.Children {
+			if i > 0 {
+				p.write(" | ")
+			}
+
+			p.entityRef(alternative.ValNode(), indent)
+
+			if len(alternative.Args) > 0 {
+				p.write(" * " + p.literal(alternative.Args[0]))
+			}
+		}
+	default:
+		p.instanceRef(node)
+	}
+}
+
+// an entity's identifier, or a template's with the arguments it is instantiated with
+func (p *printer) instanceRef(node Node) {
+	p.write(node.ValStr())
+
+	if nil != node.Args {
+		p.write("(" + p.list(node.Args) + ")")
+	}
+}
+
+func (p *printer) entity(node Node, indent string, inline bool) {
+	if node.Abstract {
+		p.write("abstract ")
+	}
+
+	if node.Name != "" {
+		p.write(node.Name + ": ")
+	}
+
+	for i, parent := range node.Parents() {
+		if i > 0 {
+			p.write("+ ")
+		}
+		p.instanceRef(parent)
+		p.write(" ")
+	}
+
+	closing := node.End() - 1
+	hasComments := p.nextOffset(closing) < closing
+
+	if len(node.Children) == 0 && !hasComments {
+		p.write("{}")
+		return
+	}
+
+	if inline && !hasComments && !strings.Contains(node.Raw, "\n") {
+		p.write("{ ")
+		for i, field := range node.Children {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.field(field, indent, 0)
+		}
+		p.write(" }")
+		return
+	}
+
+	width := 0
+	for _, field := range node.Children {
+		if label := fieldLabel(field); field.Kind == "field" && len(label) > width {
+			width = len(label)
+		}
+	}
+
+	inner := indent + formatIndent
+	p.write("{")
+
+	for i, field := range node.Children {
+		p.endLine(field.Ref.Offset)
+
+		if i > 0 && p.blankLineBefore(p.nextOffset(field.Ref.Offset)) {
+			p.blankLine()
+		}
+
+		p.commentLines(field.Ref.Offset, inner)
+		p.write(inner)
+		p.field(field, inner, width)
+
+		if i < len(node.Children)-1 {
+			p.write(",")
+		}
+	}
+
+	p.endLine(closing)
+	p.commentLines(closing, inner)
+	p.trimBlankLine()
+	p.write(indent + "}")
+}
+
+// exclusions have nothing to align, so they are written as they are
+func fieldLabel(node Node) string {
+	switch {
+	case node.Kind == "exclusion":
+		return "-" + node.Name
+	case node.Hidden:
+		return "hidden " + node.Name
+	}
+	return node.Name
+}
+
+func (p *printer) field(node Node, indent string, width int) {
+	if node.Kind == "exclusion" {
+		p.write(fieldLabel(node))
+		return
+	}
+
+	p.write(fmt.Sprintf("%-*s ", width, fieldLabel(node)))
+
+	switch value := node.ValNode(); value.Kind {
+	case "builtin":
+		p.write(value.ValStr())
+	case "identifier", "entity", "union":
+		p.entityRef(value, indent)
+	case "struct":
+		p.write("struct ")
+		p.entity(value, indent, true)
+	default:
+		p.write(p.literal(value))
+	}
+
+	if len(node.Args) > 0 {
+		p.write("(" + p.list(node.Args) + ")")
+	}
+
+	if nil != node.Bound {
+		p.write("[" + p.list(node.Bound) + "]")
+	}
+}
+
+func (p *printer) list(nodes NodeSet) string {
+	values := make([]string, len(nodes))
+	for i, node := range nodes {
+		values[i] = p.literal(node)
+	}
+	return strings.Join(values, ", ")
+}
+
+// prefers the source text so that values are never reformatted, e.g. 30.00 stays 30.00
+func (p *printer) literal(node Node) string {
+	switch node.Kind {
+	case "literal-array":
+		return "[" + p.list(node.Children) + "]"
+	case "literal-object":
+		members := make([]string, len(node.Children))
+		for i, member := range node.Children {
+			members[i] = strconv.Quote(member.Name) + ": " + p.literal(member.ValNode())
+		}
+		return "{ " + strings.Join(members, ", ") + " }"
+	}
+
+	if node.Raw != "" {
+		return node.Raw
+	}
+
+	switch node.Kind {
+	case "identifier":
+		return node.ValStr()
+	case "literal-string", "import":
+		return strconv.Quote(node.ValStr())
+	case "literal-float":
+		return strconv.FormatFloat(node.ValFloat(), 'f', -1, 64)
+	case "literal-date":
+		return node.ValTime().Format(time.RFC3339)
+	case "literal-null":
+		return "null"
+	default:
+		return fmt.Sprintf("%v", node.Value)
+	}
+}
+
+// ends the current line, keeping any comments that followed the printed code on the same line
+func (p *printer) endLine(until int) {
+	for len(p.comments) > 0 && p.comments[0].Ref.Offset < until && p.isTrailing(p.comments[0]) {
+		p.write(" " + p.comments[0].ValStr())
+		p.comments = p.comments[1:]
+	}
+	p.write("\n")
+}
+
+// prints the comments that precede the code at `until` on their own lines
+func (p *printer) commentLines(until int, indent string) {
+	printed := false
+
+	for len(p.comments) > 0 && p.comments[0].Ref.Offset < until {
+		comment := p.comments[0]
+		p.comments = p.comments[1:]
+
+		if p.blankLineBefore(comment.Ref.Offset) {
+			p.blankLine()
+		}
+
+		p.write(indent + comment.ValStr() + "\n")
+		printed = true
+	}
+
+	if printed && p.blankLineBefore(until) {
+		p.blankLine()
+	}
+}
+
+// the offset of the first unprinted comment before `until`, if any, or else `until`
+func (p *printer) nextOffset(until int) int {
+	if len(p.comments) > 0 && p.comments[0].Ref.Offset < until {
+		return p.comments[0].Ref.Offset
+	}
+	return until
+}
+
+// imports, lets and abstract entities are located by their path or name, but comments and blank lines precede the keyword
+func (p *printer) statementStart(node Node) int {
+	keyword := node.Kind
+	if node.Abstract {
+		keyword = "abstract"
+	}
+
+	if node.Kind == "import" || node.Kind == "let" || node.Abstract {
+		if idx := bytes.LastIndex(p.source[:node.Ref.Offset], []byte(keyword)); idx >= 0 {
+			return idx
+		}
+	}
+	return node.Ref.Offset
+}
+
+func (p *printer) isTrailing(comment Node) bool {
+	for i := comment.Ref.Offset - 1; i >= 0 && p.source[i] != '\n'; i-- {
+		if p.source[i] != ' ' && p.source[i] != '\t' && p.source[i] != '\r' {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *printer) blankLineBefore(offset int) bool {
+	newlines := 0
+
+	if offset > len(p.source) {
+		offset = len(p.source)
+	}
+
+	for i := offset - 1; i >= 0; i-- {
+		switch p.source[i] {
+		case '\n':
+			newlines++
+		case ' ', '\t', '\r':
+		default:
+			return newlines > 1
+		}
+	}
+
+	return false
+}
+
+// never at the start of the output or a block, and never more than one in a row
+func (p *printer) blankLine() {
+	out := p.out.Bytes()
+
+	if len(out) == 0 || bytes.HasSuffix(out, []byte("\n\n")) || bytes.HasSuffix(out, []byte("{\n")) {
+		return
+	}
+
+	p.write("\n")
+}
+
+func (p *printer) trimBlankLine() {
+	for bytes.HasSuffix(p.out.Bytes(), []byte("\n\n")) {
+		p.out.Truncate(p.out.Len() - 1)
+	}
+}
+
+func (p *printer) write(s string) {
+	p.out.WriteString(s)
+}
@@ -0,0 +1,252 @@
+package dsl
+
+import (
+	. "github.com/ThoughtWorksStudios/bobcat/test_helpers"
+	"testing"
+)
+
+func assertFormatsTo(t *testing.T, expected, source string) {
+	actual, err := Format("testScript", []byte(source))
+	AssertNil(t, err, "Didn't expect to get an error: %v", err)
+	AssertEqual(t, expected, string(actual))
+
+	again, _ := Format("testScript", actual)
+	AssertEqual(t, string(actual), string(again), "Formatting should be idempotent")
+}
+
+func TestFormatGroupsLetStatements(t *testing.T) {
+	source := `# limits
+let   ADULT=18
+let AGES = ( ADULT,65 )
+let NAMES=dict( "first_names" )
+Person: { name NAMES, age integer(AGES) }
+generate(USERS,Person)
+`
+	expected := `# limits
+let ADULT = 18
+let AGES = (ADULT, 65)
+let NAMES = dict("first_names")
+
+Person: {
+  name NAMES,
+  age  integer(AGES)
+}
+
+generate (USERS, Person)
+`
+	assertFormatsTo(t, expected, source)
+}
+
+func TestFormatTemplates(t *testing.T) {
+	source := `Product( minPrice decimal,maxPrice ):{price decimal(minPrice,maxPrice)}
+Gift:Product( 1.0,5.0 ){ wrapped true }
+generate(1,Product(1.0 , 2.0))
+`
+	expected := `Product(minPrice decimal, maxPrice): {
+  price decimal(minPrice, maxPrice)
+}
+
+Gift: Product(1.0, 5.0) {
+  wrapped true
+}
+
+generate (1, Product(1.0, 2.0))
+`
+	assertFormatsTo(t, expected, source)
+}
+
+func TestFormatEntitiesWithSeveralParents(t *testing.T) {
+	source := `Post:Content+Timestamps( 1 ){ title "hi" }
+`
+	expected := `Post: Content + Timestamps(1) {
+  title "hi"
+}
+`
+	assertFormatsTo(t, expected, source)
+}
+
+func TestFormatExcludedAndHiddenFields(t *testing.T) {
+	source := `PublicUser:User{-  password,hidden   salt string(4),
+name "ann"}
+`
+	expected := `PublicUser: User {
+  -password,
+  hidden salt string(4),
+  name        "ann"
+}
+`
+	assertFormatsTo(t, expected, source)
+}
+
+func TestFormatAbstractEntities(t *testing.T) {
+	source := `# only extended
+abstract   Mammal:{ legs 4 }
+Dog:Mammal{}
+`
+	expected := `# only extended
+abstract Mammal: {
+  legs 4
+}
+
+Dog: Mammal {}
+`
+	assertFormatsTo(t, expected, source)
+}
+
+func TestFormatUnions(t *testing.T) {
+	source := `Order:{payment CreditCard*3|BankTransfer * W|{ email "a" }[2]}
+generate(1,CreditCard|PayPal)
+`
+	expected := `Order: {
+  payment CreditCard * 3 | BankTransfer * W | { email "a" }[2]
+}
+
+generate (1, CreditCard | PayPal)
+`
+	assertFormatsTo(t, expected, source)
+}
+
+func TestFormatStructs(t *testing.T) {
+	source := `Person:{address struct{street string(10),city "Chicago"},
+  money struct {
+    amount decimal(1.0, 9.0),  currency "USD"
+  }[2]}
+`
+	expected := `Person: {
+  address struct { street string(10), city "Chicago" },
+  money   struct {
+    amount   decimal(1.0, 9.0),
+    currency "USD"
+  }[2]
+}
+`
+	assertFormatsTo(t, expected, source)
+}
+
+func TestFormatArrayAndObjectLiterals(t *testing.T) {
+	source := `let COLORS = [ "red","green",
+  "blue" ]
+Thing:{config {"depth":2,"tags":[1.50, null]},color pick( COLORS )}
+`
+	expected := `let COLORS = ["red", "green", "blue"]
+
+Thing: {
+  config { "depth": 2, "tags": [1.50, null] },
+  color  pick(COLORS)
+}
+`
+	assertFormatsTo(t, expected, source)
+}
+
+func TestFormatCanonicalizesLayout(t *testing.T) {
+	source := `import   "a.lang"
+import "b.lang"
+Person:{name string(10)   ,   age integer( 1,2 ) ,
+pets Pet[0,3]}
+Pet: Animal{}
+generate(1,Person) generate (  2 , Pet{ name "rex" })
+`
+	expected := `import "a.lang"
+import "b.lang"
+
+Person: {
+  name string(10),
+  age  integer(1, 2),
+  pets Pet[0, 3]
+}
+
+Pet: Animal {}
+
+generate (1, Person)
+generate (2, Pet { name "rex" })
+`
+	assertFormatsTo(t, expected, source)
+}
+
+func TestFormatKeepsLiteralsAsWritten(t *testing.T) {
+	source := "Thing: { price 30.00, at 2017-01-01t10:00:00+01:00, s \"\\u0041#b\", nothing null, yes true }"
+	expected := `Thing: {
+  price   30.00,
+  at      2017-01-01t10:00:00+01:00,
+  s       "\u0041#b",
+  nothing null,
+  yes     true
+}
+`
+	assertFormatsTo(t, expected, source)
+}
+
+func TestFormatKeepsComments(t *testing.T) {
+	source := `# header
+
+# about people
+Person: { # trailing the brace
+  # before name
+  name string,   # after name
+
+  age  integer # after age
+  # before the closing brace
+} # after the entity
+generate (1, Person {
+  age integer(1, 2) # nested
+})
+# the end`
+	expected := `# header
+
+# about people
+Person: { # trailing the brace
+  # before name
+  name string, # after name
+
+  age  integer # after age
+  # before the closing brace
+} # after the entity
+
+generate (1, Person {
+  age integer(1, 2) # nested
+})
+# the end
+`
+	assertFormatsTo(t, expected, source)
+}
+
+func TestFormatKeepsAtMostOneBlankLine(t *testing.T) {
+	source := "generate (1, A)\n\n\n\ngenerate (2, B)\n\n\n"
+	assertFormatsTo(t, "generate (1, A)\n\ngenerate (2, B)\n", source)
+}
+
+func TestFormatOnlyComments(t *testing.T) {
+	assertFormatsTo(t, "# one\n\n# two\n", "  # one\n\n\n# two")
+	assertFormatsTo(t, "", "\n\n")
+}
+
+func TestFormatReportsParseErrors(t *testing.T) {
+	_, err := Format("testScript", []byte("Person: { name }"))
+	Assert(t, nil != err, "Expected a parse error")
+}
+
+func TestNodesKeepSourceText(t *testing.T) {
+	ast, err := Parse("testScript", []byte("  # hi\n  Thing: { price 30.00 } # bye\n"), GlobalStore("filename", "testScript"))
+	AssertNil(t, err, "Didn't expect to get an error: %v", err)
+
+	root := ast.(Node)
+	entity := root.Children[0]
+	AssertEqual(t, "Thing: { price 30.00 }", entity.Raw)
+	AssertEqual(t, "testScript:2:3 [byte 9]", entity.Ref.String())
+	AssertEqual(t, 31, entity.End())
+	AssertEqual(t, "30.00", entity.Children[0].ValNode().Raw)
+
+	AssertEqual(t, 2, len(root.Comments))
+	AssertEqual(t, "# hi", root.Comments[0].ValStr())
+	AssertEqual(t, "# bye", root.Comments[1].ValStr())
+}
+
+func TestCodeSpan(t *testing.T) {
+	start, end := codeSpan([]byte(" # c\n  x \"#y\" # z\n "))
+	AssertEqual(t, 7, start)
+	AssertEqual(t, 13, end)
+
+	start, end = codeSpan([]byte("  # only\n"))
+	AssertEqual(t, 0, start)
+	AssertEqual(t, 0, end)
+}
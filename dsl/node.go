@@ -13,9 +13,14 @@ type Node struct {
 	Value    interface{}
 	Args     NodeSet
 	Related  *Node
+	Mixins   NodeSet // an entity's parents after the first (Related), e.g. `Post: Content + Timestamps {}`
 	Children NodeSet
 	Ref      *Location
 	Bound   NodeSet
+	Hidden   bool    // a field that is generated, but left out of the output
+	Abstract bool    // an entity that may be extended, but not generated
+	Raw      string  // the source text of the node, e.g. literals exactly as written
+	Comments NodeSet // only the root node keeps comments, in source order
 }
 
 func (n Node) String() string {
@@ -46,6 +51,10 @@ func (n Node) String() string {
 		attrs = append(attrs, fmt.Sprintf("Related: %v", n.Related))
 	}
 
+	if n.Mixins != nil {
+		attrs = append(attrs, fmt.Sprintf("Mixins: %v", n.Mixins))
+	}
+
 	if n.Children != nil {
 		attrs = append(attrs, fmt.Sprintf("Children: %v", n.Children))
 	}
@@ -54,6 +63,14 @@ func (n Node) String() string {
 		attrs = append(attrs, fmt.Sprintf("Bound: %v", n.Bound))
 	}
 
+	if n.Hidden {
+		attrs = append(attrs, "Hidden: true")
+	}
+
+	if n.Abstract {
+		attrs = append(attrs, "Abstract: true")
+	}
+
 	return fmt.Sprintf("{ %s }", strings.Join(attrs, ", "))
 }
 
@@ -61,6 +78,14 @@ func (n *Node) HasRelation() bool {
 	return n.Related != nil
 }
 
+// every entity that an entity extends, in the order they were written
+func (n Node) Parents() NodeSet {
+	if !n.HasRelation() {
+		return NodeSet{}
+	}
+	return append(NodeSet{*n.Related}, n.Mixins...)
+}
+
 func (n *Node) ValNode() Node {
 	return n.Value.(Node)
 }
@@ -81,30 +106,60 @@ func (n *Node) ValTime() time.Time {
 	return n.Value.(time.Time)
 }
 
+// the end offset (exclusive) of the node's source text
+func (n *Node) End() int {
+	if nil == n.Ref {
+		return 0
+	}
+	return n.Ref.Offset + len(n.Raw)
+}
+
+/**
+ * Locates the node at the rule that matched it, excluding any whitespace
+ * and comments that the rule consumed before or after the node itself
+ */
 func (n *Node) withPos(c *current) Node {
 	if nil != c {
 		filename, _ := c.globalStore["filename"].(string)
+		start, end := codeSpan(c.text)
+		line, col := c.pos.line, c.pos.col
+
+		for _, r := range string(c.text[:start]) {
+			if r == '\n' {
+				line, col = line+1, 1
+			} else {
+				col++
+			}
+		}
+
 		n.Ref = NewLocation(
 			filename,
-			c.pos.line,
-			c.pos.col,
-			c.pos.offset,
+			line,
+			col,
+			c.pos.offset+start,
 		)
+		n.Raw = string(c.text[start:end])
 	}
 	return *n
 }
 
 func (n *Node) Err(msg string, tokens ...interface{}) error {
-	if nil == n.Ref {
-		return fmt.Errorf(msg, tokens...)
-	} else {
-		format := fmt.Sprintf("%v %s", n.Ref, msg)
-		return fmt.Errorf(format, tokens...)
-	}
+	return n.CodedErr(CodeUnknown, msg, tokens...)
+}
+
+func (n *Node) CodedErr(code, msg string, tokens ...interface{}) error {
+	return &Diagnostic{Ref: n.Ref, Severity: SeverityError, Code: code, Msg: fmt.Sprintf(msg, tokens...)}
 }
 
+// locates inner at this node, unless inner already knows where it came from
 func (n *Node) WrapErr(inner error) error {
-	return n.Err(inner.Error())
+	if e, ok := inner.(*Diagnostic); ok {
+		if nil == e.Ref {
+			return &Diagnostic{Ref: n.Ref, Severity: e.Severity, Code: e.Code, Msg: e.Msg}
+		}
+		return e
+	}
+	return &Diagnostic{Ref: n.Ref, Severity: SeverityError, Code: CodeUnknown, Msg: inner.Error()}
 }
 
 type NodeSet []Node // bless this with functional shims
@@ -155,19 +210,19 @@ func (nodes NodeSet) Map(f Collector) []interface{} {
 }
 
 type Location struct {
-	line, col, offset int
-	filename          string
+	Line, Col, Offset int
+	Filename          string
 }
 
 func NewLocation(filename string, line, col, offset int) *Location {
 	return &Location{
-		filename: filename,
-		line:     line,
-		col:      col,
-		offset:   offset,
+		Filename: filename,
+		Line:     line,
+		Col:      col,
+		Offset:   offset,
 	}
 }
 
 func (l *Location) String() string {
-	return fmt.Sprintf("%s:%d:%d [byte %d]", l.filename, l.line, l.col, l.offset)
+	return fmt.Sprintf("%s:%d:%d [byte %d]", l.Filename, l.Line, l.Col, l.Offset)
 }
@@ -1,6 +1,7 @@
 package dsl
 
 import (
+	"sort"
 	"strconv"
 	"strings"
 )
@@ -13,46 +14,227 @@ func rootNode(c *current, statements interface{}) (Node, error) {
 	node := &Node{
 		Kind:     "root",
 		Children: searchNodes(statements),
+		Comments: NodeSet{},
 	}
+
+	if comments, ok := c.globalStore["comments"].(map[int]Node); ok {
+		for _, comment := range comments {
+			node.Comments = append(node.Comments, comment)
+		}
+
+		sort.Slice(node.Comments, func(a, b int) bool {
+			return node.Comments[a].Ref.Offset < node.Comments[b].Ref.Offset
+		})
+	}
+
 	return node.withPos(c), nil
 }
 
-func importNode(c *current, path string) (Node, error) {
+/**
+ * Comments may be matched more than once as the parser backtracks, so they
+ * are recorded by offset and only attached to the AST once parsing is done
+ */
+func commentNode(c *current) (Node, error) {
+	text := strings.TrimRight(string(c.text), "\r\n")
+	filename, _ := c.globalStore["filename"].(string)
+
+	node := Node{
+		Kind:  "comment",
+		Value: strings.TrimRight(text, " \t"),
+		Ref:   NewLocation(filename, c.pos.line, c.pos.col, c.pos.offset),
+		Raw:   text,
+	}
+
+	comments, ok := c.globalStore["comments"].(map[int]Node)
+	if !ok {
+		comments = make(map[int]Node)
+		c.globalStore["comments"] = comments
+	}
+
+	comments[c.pos.offset] = node
+	return node, nil
+}
+
+func importNode(c *current, path string, pathNode Node) (Node, error) {
 	node := &Node{
 		Kind:  "import",
 		Value: path,
 	}
 
-	return node.withPos(c), nil
+	node.withPos(c)
+
+	// locate imports by their path rather than the `import` keyword
+	if nil != pathNode.Ref {
+		node.Ref, node.Raw = pathNode.Ref, pathNode.Raw
+	}
+
+	return *node, nil
 }
 
 func entityNode(c *current, assignment, entity interface{}) (Node, error) {
 	node, _ := entity.(Node)
+	node.withPos(c)
 
 	if nil != assignment {
-		node.Name = assignment.(Node).Name
+		assign := assignment.(Node)
+		node.Name = assign.Name
+
+		// locate named entities by their name rather than any whitespace or modifiers preceding it
+		if nil != assign.Ref {
+			if nil != node.Ref {
+				node.Raw = node.Raw[assign.Ref.Offset-node.Ref.Offset:]
+			}
+			node.Ref = assign.Ref
+		}
+	}
+
+	return node, nil
+}
+
+func unionNode(c *current, alternatives NodeSet) (Node, error) {
+	node := &Node{
+		Kind:     "union",
+		Children: alternatives,
+	}
+	return node.withPos(c), nil
+}
+
+func structNode(c *current, body interface{}) (Node, error) {
+	node := &Node{
+		Kind:     "struct",
+		Children: defaultToEmptySlice(body),
 	}
+	return node.withPos(c), nil
+}
 
+// an alternative's weight, if it has one, is its only argument
+func alternativeNode(c *current, entity, weight interface{}) (Node, error) {
+	node := &Node{
+		Kind:  "alternative",
+		Value: entity.(Node),
+	}
+
+	if nil != weight {
+		node.Args = searchNodes(weight)
+	}
 	return node.withPos(c), nil
 }
 
+// abstract entities are only there to be extended, and can't be generated themselves
+func abstractEntityNode(c *current, assignment, entity interface{}) (Node, error) {
+	node, err := entityNode(c, assignment, entity)
+	node.Abstract = true
+	return node, err
+}
+
 func entityDefNode(c *current, extends, body interface{}) (Node, error) {
 	node := &Node{
 		Kind:     "entity",
 		Children: defaultToEmptySlice(body),
 	}
 
-	if nil != extends {
-		if parentIdentNode, ok := extends.(Node); ok {
-			node.Related = &parentIdentNode
-		} else {
-			return *node, node.Err("Entity cannot extend %T %v", extends, extends)
+	switch parents := extends.(type) {
+	case nil:
+	case Node:
+		node.Related = &parents
+	case NodeSet:
+		node.Related = &parents[0]
+
+		if len(parents) > 1 {
+			node.Mixins = parents[1:]
 		}
+	default:
+		return *node, node.Err("Entity cannot extend %T %v", extends, extends)
+	}
+
+	return node.withPos(c), nil
+}
+
+// let statements are located by their name, like named entities
+func letNode(c *current, ident, value interface{}) (Node, error) {
+	name := ident.(Node)
+	node := &Node{
+		Kind:  "let",
+		Name:  identStr(ident),
+		Value: value.(Node),
+	}
+
+	node.withPos(c)
+
+	if nil != name.Ref {
+		node.Ref, node.Raw = name.Ref, name.Raw
+	}
+
+	return *node, nil
+}
+
+// the bounds of a range bound with `let`, e.g. (18, 65)
+func rangeNode(c *current, args interface{}) (Node, error) {
+	node := &Node{
+		Kind: "range",
+		Args: defaultToEmptySlice(args),
+	}
+	return node.withPos(c), nil
+}
+
+// a dictionary bound with `let`, e.g. dict("first_names")
+func dictValueNode(c *current, args interface{}) (Node, error) {
+	node := &Node{
+		Kind:  "builtin",
+		Value: "dict",
+		Args:  defaultToEmptySlice(args),
+	}
+	return node.withPos(c), nil
+}
+
+/**
+ * An entity definition with parameters, which is instantiated with arguments wherever
+ * an entity may be referred to; the parameters are kept in Args
+ */
+func templateNode(c *current, ident, params, entity interface{}) (Node, error) {
+	name := ident.(Node)
+	node := &Node{
+		Kind:  "template",
+		Name:  identStr(ident),
+		Value: entity.(Node),
+		Args:  params.(NodeSet),
+	}
+
+	node.withPos(c)
+
+	// locate templates by their name, like named entities
+	if nil != name.Ref {
+		node.Ref = name.Ref
+	}
+
+	return *node, nil
+}
+
+// Value is the parameter's built-in type, if it has one
+func paramNode(c *current, ident, paramType interface{}) (Node, error) {
+	node := &Node{
+		Kind: "param",
+		Name: identStr(ident),
+	}
+
+	if nil != paramType {
+		node.Value = paramType.(Node)
 	}
 
 	return node.withPos(c), nil
 }
 
+// an identifier that instantiates a template keeps the arguments in Args
+func instanceNode(ident, args interface{}) (Node, error) {
+	node := ident.(Node)
+
+	if nil != args {
+		node.Args = args.(NodeSet)
+	}
+
+	return node, nil
+}
+
 func genNode(c *current, entity, args interface{}) (Node, error) {
 	node := &Node{
 		Kind:  "generation",
@@ -82,6 +264,21 @@ func dynamicFieldNode(c *current, ident, fieldType, args interface{}, bound Node
 	return node.withPos(c), nil
 }
 
+func exclusionNode(c *current, ident interface{}) (Node, error) {
+	node := &Node{
+		Kind: "exclusion",
+		Name: identStr(ident),
+	}
+	return node.withPos(c), nil
+}
+
+// located from the `hidden` keyword, so that the whole declaration is kept in Raw
+func hiddenFieldNode(c *current, field interface{}) (Node, error) {
+	node := field.(Node)
+	node.Hidden = true
+	return node.withPos(c), nil
+}
+
 func assignNode(c *current, ident interface{}) (Node, error) {
 	node := &Node{
 		Kind: "Assignment",
@@ -164,6 +361,45 @@ func boolLiteralNode(c *current, value string) (Node, error) {
 	return node.withPos(c), er
 }
 
+// an array's value is its elements' values, so that it can be used as is
+func arrayLiteralNode(c *current, elements NodeSet) (Node, error) {
+	values := make([]interface{}, len(elements))
+	for idx, element := range elements {
+		values[idx] = element.Value
+	}
+
+	node := &Node{
+		Kind:     "literal-array",
+		Value:    values,
+		Children: elements,
+	}
+	return node.withPos(c), nil
+}
+
+func objectLiteralNode(c *current, members NodeSet) (Node, error) {
+	values := make(map[string]interface{}, len(members))
+	for _, member := range members {
+		values[member.Name] = member.ValNode().Value
+	}
+
+	node := &Node{
+		Kind:     "literal-object",
+		Value:    values,
+		Children: members,
+	}
+	return node.withPos(c), nil
+}
+
+func memberNode(c *current, key, value interface{}) (Node, error) {
+	name := key.(Node)
+	node := &Node{
+		Kind:  "member",
+		Name:  name.ValStr(),
+		Value: value.(Node),
+	}
+	return node.withPos(c), nil
+}
+
 func strLiteralNode(c *current, value string) (Node, error) {
 	val, er := strconv.Unquote(value)
 
@@ -47,3 +47,20 @@ func TestHasRelation(t *testing.T) {
 	Assert(t, !noRelations.HasRelation(), "if node does not have related node, should report false")
 	Assert(t, withRelations.HasRelation(), "if node has related node, should report true")
 }
+
+func TestErrIncludesLocationAndCode(t *testing.T) {
+	node := Node{Ref: NewLocation("eek", 2, 3, 10)}
+	err := node.CodedErr(CodeInvalidRange, "bad %s", "range")
+
+	AssertEqual(t, "eek:2:3 [byte 10] bad range", err.Error())
+	AssertEqual(t, CodeInvalidRange, err.(*Diagnostic).Code)
+}
+
+func TestWrapErrDoesNotRelocateLocatedErrors(t *testing.T) {
+	outer := Node{Ref: NewLocation("eek", 1, 1, 0)}
+	inner := Node{Ref: NewLocation("eek", 2, 3, 10)}
+
+	AssertEqual(t, "eek:2:3 [byte 10] nope", outer.WrapErr(inner.Err("nope")).Error())
+	AssertEqual(t, "eek:1:1 [byte 0] nope", outer.WrapErr(NewError(CodeSyntax, "nope")).Error())
+	AssertEqual(t, CodeSyntax, outer.WrapErr(NewError(CodeSyntax, "nope")).(*Diagnostic).Code)
+}
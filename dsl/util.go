@@ -19,6 +19,10 @@ func searchNodes(v interface{}) NodeSet {
 	for _, val := range vars {
 		n, isNode := val.(Node)
 
+		if isNode && n.Kind == "comment" {
+			continue // comments are collected separately by rootNode()
+		}
+
 		if isNode {
 			nodes = append(nodes, n)
 		} else {
@@ -33,6 +37,51 @@ func searchNodes(v interface{}) NodeSet {
 	return nodes
 }
 
+/**
+ * Finds the bounds of the text between any leading and trailing whitespace
+ * and comments; a '#' within a string literal does not start a comment
+ */
+func codeSpan(text []byte) (int, int) {
+	start, end := -1, 0
+
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case ' ', '\t', '\r', '\n':
+			continue
+		case '#':
+			for i < len(text) && text[i] != '\n' && text[i] != '\r' {
+				i++
+			}
+			continue
+		case '"':
+			if start < 0 {
+				start = i
+			}
+
+			for i++; i < len(text) && text[i] != '"'; i++ {
+				if text[i] == '\\' {
+					i++
+				}
+			}
+		}
+
+		if start < 0 {
+			start = i
+		}
+		end = i + 1
+	}
+
+	if start < 0 {
+		return 0, 0
+	}
+
+	if end > len(text) {
+		end = len(text)
+	}
+
+	return start, end
+}
+
 // convenience function to join a single Node with a
 // Node slice representing 0 or more Node values; Often
 // used to handle arguments, filtering out whitespace and
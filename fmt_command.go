@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"github.com/ThoughtWorksStudios/bobcat/dsl"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+)
+
+const diffContext = 3
+
+func runFmtCommand(args []string) {
+	flags := flag.NewFlagSet("fmt", flag.ExitOnError)
+	flags.Usage = func() {
+		log.Print("Usage: ./bobcat fmt [ -w | -d ] [ spec_file.lang ... ]")
+		log.Print("\nFormats specs in the canonical layout; reads STDIN when no files are given.\n\nOptions:")
+		flags.PrintDefaults()
+	}
+	write := flags.Bool("w", false, "rewrite files in place instead of printing them to STDOUT")
+	diff := flags.Bool("d", false, "print a diff instead of the formatted spec, and exit with status 1 if any file needs formatting")
+	flags.Parse(args)
+
+	failed, unformatted := false, false
+
+	if flags.NArg() == 0 {
+		if *write {
+			log.Print("Cannot use -w with STDIN")
+			os.Exit(1)
+		}
+
+		source, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		changed, err := formatSpec("<stdin>", source, false, *diff)
+		failed, unformatted = err != nil, changed
+	}
+
+	for _, filename := range flags.Args() {
+		source, err := ioutil.ReadFile(filename)
+		if err != nil {
+			log.Print(err)
+			failed = true
+			continue
+		}
+
+		changed, err := formatSpec(filename, source, *write, *diff)
+		failed, unformatted = failed || err != nil, unformatted || changed
+	}
+
+	if failed || (*diff && unformatted) {
+		os.Exit(1)
+	}
+}
+
+func formatSpec(filename string, source []byte, write, diff bool) (bool, error) {
+	formatted, err := dsl.Format(filename, source)
+
+	if err != nil {
+		for _, e := range dsl.ParseErrors(filename, err) {
+			log.Print(dsl.Render(e))
+		}
+		return false, err
+	}
+
+	changed := !bytes.Equal(source, formatted)
+
+	if diff && changed {
+		fmt.Print(unifiedDiff(filename, string(source), string(formatted)))
+	}
+
+	if write && changed {
+		info, err := os.Stat(filename)
+		if err == nil {
+			err = ioutil.WriteFile(filename, formatted, info.Mode())
+		}
+
+		if err != nil {
+			log.Print(err)
+			return changed, err
+		}
+	}
+
+	if !write && !diff {
+		os.Stdout.Write(formatted)
+	}
+
+	return changed, nil
+}
+
+type diffLine struct {
+	op   byte // ' ', '-', or '+'
+	text string
+}
+
+/**
+ * A minimal unified diff of two texts, computed from the longest common
+ * subsequence of their lines; specs are small enough that this is quick
+ */
+func unifiedDiff(filename, before, after string) string {
+	a, b := diffLines(before), diffLines(after)
+	lcs := make([][]int, len(a)+1)
+
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	lines := make([]diffLine, 0, len(a)+len(b))
+
+	for i, j := 0, 0; i < len(a) || j < len(b); {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			lines = append(lines, diffLine{' ', a[i]})
+			i, j = i+1, j+1
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			lines = append(lines, diffLine{'-', a[i]})
+			i++
+		default:
+			lines = append(lines, diffLine{'+', b[j]})
+			j++
+		}
+	}
+
+	out := &bytes.Buffer{}
+	fmt.Fprintf(out, "--- %s\n+++ %s (formatted)\n", filename, filename)
+
+	for start := 0; start < len(lines); {
+		first := nextChange(lines, start)
+		if first < 0 {
+			break
+		}
+
+		// extend the hunk until the gap to the next change is wider than the context on both sides
+		last := first
+		for next := nextChange(lines, last+1); next >= 0 && next-last <= 2*diffContext; next = nextChange(lines, last+1) {
+			last = next
+		}
+
+		from, to := maxInt(first-diffContext, start), minInt(last+diffContext+1, len(lines))
+		aStart, bStart := 1, 1
+
+		for _, l := range lines[:from] {
+			if l.op != '+' {
+				aStart++
+			}
+			if l.op != '-' {
+				bStart++
+			}
+		}
+
+		aCount, bCount := 0, 0
+		for _, l := range lines[from:to] {
+			if l.op != '+' {
+				aCount++
+			}
+			if l.op != '-' {
+				bCount++
+			}
+		}
+
+		fmt.Fprintf(out, "@@ -%d,%d +%d,%d @@\n", aStart, aCount, bStart, bCount)
+
+		for _, l := range lines[from:to] {
+			out.WriteByte(l.op)
+			out.WriteString(strings.TrimSuffix(l.text, "\n") + "\n")
+		}
+
+		start = to
+	}
+
+	return out.String()
+}
+
+func diffLines(text string) []string {
+	lines := strings.SplitAfter(text, "\n")
+
+	if lines[len(lines)-1] == "" {
+		return lines[:len(lines)-1]
+	}
+	return lines
+}
+
+func nextChange(lines []diffLine, from int) int {
+	for i := from; i < len(lines); i++ {
+		if lines[i].op != ' ' {
+			return i
+		}
+	}
+	return -1
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
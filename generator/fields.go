@@ -8,10 +8,14 @@ import (
 	"time"
 )
 
+/**
+ * Fields draw their random values from the rng they are given, so that each
+ * run (or each batch of a parallel run) has its own stream
+ */
 type Field interface {
 	Type() string
-	GenerateValue() interface{}
-	Amount() int
+	GenerateValue(rng *rand.Rand) interface{}
+	Amount(rng *rand.Rand) int
 	Multiple() bool
 }
 
@@ -27,9 +31,9 @@ func (field *ReferenceField) Type() string {
 	return "reference"
 }
 
-func (field *ReferenceField) GenerateValue() interface{} {
+func (field *ReferenceField) GenerateValue(rng *rand.Rand) interface{} {
 	referredField := field.referred.fields[field.fieldName]
-	return referredField.GenerateValue()
+	return referredField.GenerateValue(rng)
 }
 
 func (field *ReferenceField) referencedField() Field {
@@ -50,10 +54,9 @@ func (field *EntityField) Type() string {
 	return "entity"
 }
 
-func (field *EntityField) GenerateValue() interface{} {
-	entities := make(map[string]GeneratedEntities)
-	entities[field.entityGenerator.Type()] = field.entityGenerator.Generate(1)
-	return entities
+// a single nested entity, generated on its own rather than as part of its parent
+func (field *EntityField) GenerateValue(rng *rand.Rand) interface{} {
+	return Compile(field.entityGenerator).nest(&generation{limit: DefaultNestingLimit(), rng: rng})
 }
 
 type UuidField struct{
@@ -64,8 +67,13 @@ func (field *UuidField) Type() string {
 	return "uuid"
 }
 
-func (field *UuidField) GenerateValue() interface{} {
-	return uuid.NewV4()
+// version 4 UUIDs, but from rng rather than crypto/rand so that seeded runs are repeatable
+func (field *UuidField) GenerateValue(rng *rand.Rand) interface{} {
+	id := uuid.UUID{}
+	rng.Read(id[:])
+	id.SetVersion(uuid.V4)
+	id.SetVariant(uuid.VariantRFC4122)
+	return id
 }
 
 type LiteralField struct {
@@ -77,10 +85,45 @@ func (field *LiteralField) Type() string {
 	return "literal"
 }
 
-func (field *LiteralField) GenerateValue() interface{} {
-	return field.value
+// arrays and objects are copied, so that no two entities share them
+func (field *LiteralField) GenerateValue(rng *rand.Rand) interface{} {
+	return copyValue(field.value)
+}
+
+func copyValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for idx, element := range v {
+			result[idx] = copyValue(element)
+		}
+		return result
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, member := range v {
+			result[key] = copyValue(member)
+		}
+		return result
+	}
+	return value
+}
+
+// one of the elements of an array literal, e.g. pick(["red", "green", "blue"])
+type PickField struct {
+	values []interface{}
+	*Bound
+}
+
+func (field *PickField) Type() string {
+	return "pick"
+}
+
+func (field *PickField) GenerateValue(rng *rand.Rand) interface{} {
+	return copyValue(field.values[rng.Intn(len(field.values))])
 }
 
+var allowedChars = []byte(`abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789!'@#$%^&*()_+-=[]{};:",./?`)
+
 type StringField struct {
 	length int
   *Bound
@@ -90,12 +133,11 @@ func (field *StringField) Type() string {
 	return "string"
 }
 
-func (field *StringField) GenerateValue() interface{} {
-	allowedChars := []rune(`abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789!'@#$%^&*()_+-=[]{};:",./?`)
-	result := []rune{}
-	nTimes := rand.Intn(field.length-field.length+1) + field.length
+func (field *StringField) GenerateValue(rng *rand.Rand) interface{} {
+	nTimes := rng.Intn(field.length-field.length+1) + field.length
+	result := make([]byte, nTimes)
 	for i := 0; i < nTimes; i++ {
-		result = append(result, allowedChars[rand.Intn(len(allowedChars))])
+		result[i] = allowedChars[rng.Intn(len(allowedChars))]
 	}
 	return string(result)
 }
@@ -110,8 +152,8 @@ func (field *IntegerField) Type() string {
 	return "integer"
 }
 
-func (field *IntegerField) GenerateValue() interface{} {
-	result := float64(rand.Intn(int(field.max - field.min + 1)))
+func (field *IntegerField) GenerateValue(rng *rand.Rand) interface{} {
+	result := float64(rng.Intn(int(field.max - field.min + 1)))
 	result += float64(field.min)
 	return int(result)
 }
@@ -126,8 +168,8 @@ func (field *FloatField) Type() string {
 	return "float"
 }
 
-func (field *FloatField) GenerateValue() interface{} {
-	return float64(rand.Intn(int(field.max-field.min))) + field.min + rand.Float64()
+func (field *FloatField) GenerateValue(rng *rand.Rand) interface{} {
+	return float64(rng.Intn(int(field.max-field.min))) + field.min + rng.Float64()
 }
 
 type DateField struct {
@@ -144,26 +186,24 @@ func (field *DateField) ValidBounds() bool {
 	return field.min.Before(field.max)
 }
 
-func (field *DateField) GenerateValue() interface{} {
+func (field *DateField) GenerateValue(rng *rand.Rand) interface{} {
 	min, max := field.min.Unix(), field.max.Unix()
 	delta := max - min
-	sec := rand.Int63n(delta) + min
+	sec := rng.Int63n(delta) + min
 
 	return time.Unix(sec, 0)
 }
 
 type DictField struct {
-	category string
+	category   string
+	dictionary *dictionary.Dictionary
   *Bound
 }
 
-var CustomDictPath = ""
-
 func (field *DictField) Type() string {
 	return "dict"
 }
 
-func (field *DictField) GenerateValue() interface{} {
-	dictionary.SetCustomDataLocation(CustomDictPath)
-	return dictionary.ValueFromDictionary(field.category)
+func (field *DictField) GenerateValue(rng *rand.Rand) interface{} {
+	return field.dictionary.Value(field.category, rng)
 }
@@ -9,8 +9,5 @@ func NewGeneratedEntities(count int64) GeneratedEntities {
 }
 
 func (ge GeneratedEntities) Concat(newEntities GeneratedEntities) GeneratedEntities {
-	for _, entity := range newEntities {
-		ge = append(ge, entity)
-	}
-	return ge
+	return append(ge, newEntities...)
 }
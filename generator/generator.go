@@ -3,34 +3,135 @@ package generator
 import (
 	"fmt"
 	. "github.com/ThoughtWorksStudios/bobcat/common"
+	"github.com/ThoughtWorksStudios/bobcat/dictionary"
 	"github.com/ThoughtWorksStudios/bobcat/logging"
-	"sort"
 	"strings"
 	"time"
 )
 
 type Generator struct {
-	name   string
-	base   string
-	fields FieldSet
-	log    logging.ILogger
+	name         string
+	base         string
+	ancestors    []string // the types of every entity this one extends, nearest first
+	fields       FieldSet
+	order        []string        // the names of non-metadata fields in the order they were declared
+	hidden       map[string]bool // fields that are generated, but left out of the output
+	abstract     bool            // only there to be extended; extensions are concrete unless marked otherwise
+	alternatives []*Generator    // a union's, one of which generates each entity
+	weights      []int           // how often each alternative is picked, relative to the others
+	plain        bool            // a struct's, which are nested as plain objects
+	log          logging.ILogger
+	dictionary   *dictionary.Dictionary
 }
 
-func ExtendGenerator(name string, parent *Generator) *Generator {
-	gen := NewGenerator(name, parent.log)
-	gen.base = parent.Type()
-	gen.fields["$extends"] = &LiteralField{value: gen.base}
+// metadata fields come before all others, in this order
+var metadataOrder = []string{"$id", "$type", "$species", "$extends", "$parent"}
+
+/**
+ * Extends one or more parents, the first of which gives an anonymous extension its
+ * type. Fields are inherited from each parent in turn, so where parents declare
+ * the same field, the later parent's wins; the extension's own fields win over
+ * all of them. Inherited fields are ordered as they first appear among the parents.
+ */
+func ExtendGenerator(name string, parents ...*Generator) *Generator {
+	gen := NewGenerator(name, parents[0].log)
+	gen.base = parents[0].Type()
+	gen.dictionary = parents[0].dictionary
 	gen.fields["$type"] = &LiteralField{value: gen.Type()}
 
-	for key, _ := range parent.fields {
-		if _, hasField := gen.fields[key]; !hasField || !strings.HasPrefix(key, "$") {
+	seen := make(map[string]bool)
+
+	for _, parent := range parents {
+		for _, ancestor := range append([]string{parent.Type()}, parent.ancestors...) {
+			if !seen[ancestor] {
+				seen[ancestor] = true
+				gen.ancestors = append(gen.ancestors, ancestor)
+			}
+		}
+
+		for _, key := range parent.order { // inherited fields keep their place, even when overridden
+			if _, hasField := gen.fields[key]; !hasField {
+				gen.order = append(gen.order, key)
+			}
 			gen.fields[key] = &ReferenceField{referred: parent, fieldName: key}
+			gen.hidden[key] = parent.hidden[key]
 		}
 	}
 
+	// a single parent keeps $extends a plain type, as it was before entities could have several
+	if len(parents) == 1 {
+		gen.fields["$extends"] = &LiteralField{value: gen.base}
+	} else {
+		gen.fields["$extends"] = &LiteralField{value: gen.ancestors}
+	}
 	return gen
 }
 
+/**
+ * A union of entities, e.g. `CreditCard * 3 | BankTransfer | PayPal`, generates
+ * each entity from one of its alternatives, picked at random in proportion to
+ * their weights, so that the entities' $type tells them apart. A union's type is
+ * the nearest ancestor that all of its alternatives share, or else their types
+ * joined with "|".
+ */
+func NewUnion(alternatives []*Generator, weights []int) *Generator {
+	return &Generator{
+		name:         unionType(alternatives),
+		fields:       make(map[string]Field),
+		hidden:       make(map[string]bool),
+		log:          alternatives[0].log,
+		dictionary:   alternatives[0].dictionary,
+		alternatives: alternatives,
+		weights:      weights,
+	}
+}
+
+func unionType(alternatives []*Generator) string {
+	first := alternatives[0]
+
+	for _, candidate := range append([]string{first.Type()}, first.ancestors...) {
+		shared := true
+
+		for _, alternative := range alternatives[1:] {
+			if !alternative.isA(candidate) {
+				shared = false
+				break
+			}
+		}
+
+		if shared {
+			return candidate
+		}
+	}
+
+	types := make([]string, len(alternatives))
+	for idx, alternative := range alternatives {
+		types[idx] = alternative.Type()
+	}
+	return strings.Join(types, "|")
+}
+
+func (g *Generator) isA(entityType string) bool {
+	if g.Type() == entityType {
+		return true
+	}
+
+	for _, ancestor := range g.ancestors {
+		if ancestor == entityType {
+			return true
+		}
+	}
+	return false
+}
+
+// the entities that a union picks from, or else just the entity itself
+func (g *Generator) Alternatives() []*Generator {
+	if len(g.alternatives) > 0 {
+		return g.alternatives
+	}
+	return []*Generator{g}
+}
+
 func NewGenerator(name string, logger logging.ILogger) *Generator {
 	if logger == nil {
 		logger = &logging.DefaultLogger{}
@@ -40,7 +141,7 @@ func NewGenerator(name string, logger logging.ILogger) *Generator {
 		name = "$"
 	}
 
-	g := &Generator{name: name, fields: make(map[string]Field), log: logger}
+	g := &Generator{name: name, fields: make(map[string]Field), hidden: make(map[string]bool), log: logger, dictionary: dictionary.New("")}
 
 	g.fields["$id"] = &UuidField{}
 
@@ -50,16 +151,93 @@ func NewGenerator(name string, logger logging.ILogger) *Generator {
 	return g
 }
 
+/**
+ * A struct is a value object, e.g. an address or an amount of money, nested as a
+ * plain object: it has no $id, $type or $species, isn't wrapped in {"Type": [...]},
+ * and the entities nested in it are children of the entity that declares it.
+ */
+func NewStruct(logger logging.ILogger) *Generator {
+	if logger == nil {
+		logger = &logging.DefaultLogger{}
+	}
+
+	return &Generator{name: "struct", plain: true, fields: make(map[string]Field), hidden: make(map[string]bool), log: logger, dictionary: dictionary.New("")}
+}
+
+func (g *Generator) SetAbstract(abstract bool) *Generator {
+	g.abstract = abstract
+	return g
+}
+
+func (g *Generator) Abstract() bool {
+	return g.abstract
+}
+
+// where dict() fields added from now on look up their values
+func (g *Generator) WithDictionary(d *dictionary.Dictionary) *Generator {
+	g.dictionary = d
+	return g
+}
+
 func (g *Generator) WithStaticField(fieldName string, fieldValue interface{}) error {
-	g.fields[fieldName] = &LiteralField{value: fieldValue}
+	g.setField(fieldName, &LiteralField{value: fieldValue})
 	return nil
 }
 
 func (g *Generator) WithEntityField(fieldName string, entityGenerator *Generator, fieldArgs interface{}, fieldBound *Bound) error {
-	g.fields[fieldName] = &EntityField{entityGenerator: entityGenerator, Bound: fieldBound}
+	g.setField(fieldName, &EntityField{entityGenerator: entityGenerator, Bound: fieldBound})
+	return nil
+}
+
+// redefining a field replaces it without moving it, and shows it again if it was hidden
+func (g *Generator) setField(fieldName string, field Field) {
+	if _, defined := g.fields[fieldName]; !defined && !strings.HasPrefix(fieldName, "$") {
+		g.order = append(g.order, fieldName)
+	}
+	g.fields[fieldName] = field
+	delete(g.hidden, fieldName)
+}
+
+// a hidden field is generated (and inherited) like any other, but left out of the output
+func (g *Generator) HideField(fieldName string) error {
+	if _, defined := g.fields[fieldName]; !defined || strings.HasPrefix(fieldName, "$") {
+		return fmt.Errorf("%s has no field %q to hide", g.Type(), fieldName)
+	}
+	g.hidden[fieldName] = true
 	return nil
 }
 
+// drops an inherited field, as if the parent had never declared it
+func (g *Generator) WithoutField(fieldName string) error {
+	if _, inherited := g.fields[fieldName].(*ReferenceField); !inherited {
+		return fmt.Errorf("%s has no inherited field %q to exclude", g.Type(), fieldName)
+	}
+
+	delete(g.fields, fieldName)
+	delete(g.hidden, fieldName)
+
+	for idx, name := range g.order {
+		if name == fieldName {
+			g.order = append(g.order[:idx:idx], g.order[idx+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// metadata first, then the other fields in the order they were declared, inherited ones first
+func (g *Generator) fieldNames() []string {
+	names := make([]string, 0, len(g.fields))
+
+	for _, name := range metadataOrder {
+		if _, defined := g.fields[name]; defined {
+			names = append(names, name)
+		}
+	}
+
+	return append(names, g.order...)
+}
+
 func (g *Generator) WithField(fieldName, fieldType string, fieldArgs interface{}, fieldBound *Bound) error {
 	if fieldArgs == nil {
 		return fmt.Errorf("FieldArgs are nil for field '%s', this should never happen!", fieldName)
@@ -68,7 +246,7 @@ func (g *Generator) WithField(fieldName, fieldType string, fieldArgs interface{}
 	switch fieldType {
 	case "string":
 		if ln, ok := fieldArgs.(int); ok {
-			g.fields[fieldName] = &StringField{length: ln, Bound: fieldBound}
+			g.setField(fieldName, &StringField{length: ln, Bound: fieldBound})
 		} else {
 			return fmt.Errorf("expected field args to be of type 'int' for field %s (%s), but got %v",
 				fieldName, fieldType, fieldArgs)
@@ -80,7 +258,7 @@ func (g *Generator) WithField(fieldName, fieldType string, fieldArgs interface{}
 				return fmt.Errorf("max %v cannot be less than min %v", max, min)
 			}
 
-			g.fields[fieldName] = &IntegerField{min: min, max: max, Bound: fieldBound}
+			g.setField(fieldName, &IntegerField{min: min, max: max, Bound: fieldBound})
 		} else {
 			return fmt.Errorf("expected field args to be of type '(min:int, max:int)' for field %s (%s), but got %v", fieldName, fieldType, fieldArgs)
 		}
@@ -90,7 +268,7 @@ func (g *Generator) WithField(fieldName, fieldType string, fieldArgs interface{}
 			if max < min {
 				return fmt.Errorf("max %v cannot be less than min %v", max, min)
 			}
-			g.fields[fieldName] = &FloatField{min: min, max: max, Bound: fieldBound}
+			g.setField(fieldName, &FloatField{min: min, max: max, Bound: fieldBound})
 		} else {
 			return fmt.Errorf("expected field args to be of type '(min:float64, max:float64)' for field %s (%s), but got %v", fieldName, fieldType, fieldArgs)
 		}
@@ -101,18 +279,24 @@ func (g *Generator) WithField(fieldName, fieldType string, fieldArgs interface{}
 			if !field.ValidBounds() {
 				return fmt.Errorf("max %v cannot be before min %v", max, min)
 			}
-			g.fields[fieldName] = field
+			g.setField(fieldName, field)
 		} else {
 			return fmt.Errorf("expected field args to be of type 'time.Time' for field %s (%s), but got %v", fieldName, fieldType, fieldArgs)
 		}
 	case "uuid":
-		g.fields[fieldName] = &UuidField{}
+		g.setField(fieldName, &UuidField{})
 	case "dict":
 		if dict, ok := fieldArgs.(string); ok {
-			g.fields[fieldName] = &DictField{category: dict, Bound: fieldBound}
+			g.setField(fieldName, &DictField{category: dict, dictionary: g.dictionary, Bound: fieldBound})
 		} else {
 			return fmt.Errorf("expected field args to be of type 'string' for field %s (%s), but got %v", fieldName, fieldType, fieldArgs)
 		}
+	case "pick":
+		if values, ok := fieldArgs.([]interface{}); ok && len(values) > 0 {
+			g.setField(fieldName, &PickField{values: values, Bound: fieldBound})
+		} else {
+			return fmt.Errorf("expected field args to be a non-empty array for field %s (%s), but got %v", fieldName, fieldType, fieldArgs)
+		}
 	default:
 		return fmt.Errorf("Invalid field type '%v'", fieldType)
 	}
@@ -128,40 +312,217 @@ func (g *Generator) Type() string {
 }
 
 func (g *Generator) Generate(count int64) GeneratedEntities {
-	entities := NewGeneratedEntities(count)
-	for i := int64(0); i < count; i++ {
-		entity := EntityResult{}
-		for _, name := range sortKeys(g.fields) { // need $name fields generated first
-			field := g.fields[name]
-			if field.Type() == "entity" { // add reference to parent entity
-				field.(*EntityField).entityGenerator.fields["$parent"] = &LiteralField{value: entity["$id"]}
+	return g.GenerateLimited(count, DefaultNestingLimit())
+}
+
+/**
+ * Generates entities, cutting off any entity that nests itself (directly or
+ * through other entities) deeper than the limit allows
+ */
+func (g *Generator) GenerateLimited(count int64, limit NestingLimit) GeneratedEntities {
+	entities := NewGeneratedEntities(0)
+
+	g.GenerateInto(count, Options{Nesting: limit, Workers: 1, Seed: randomSeed()}, func(batch GeneratedEntities) error {
+		entities = entities.Concat(batch)
+		return nil
+	})
+
+	return entities
+}
+
+// inherited fields are generated by the field they refer to
+func resolveField(field Field) Field {
+	if ref, isRef := field.(*ReferenceField); isRef {
+		return ref.referencedField()
+	}
+	return field
+}
+
+// a summary of a resolved field, for tooling that needs to show an entity's shape
+type FieldInfo struct {
+	Name      string
+	Type      string
+	Inherited bool
+	Origin    string // the entity that declares the field
+	Hidden    bool
+}
+
+/**
+ * Describes the fields of an entity in the order they were declared, including
+ * inherited ones (resolved to their declaring ancestor) but excluding $-prefixed
+ * metadata
+ */
+func (g *Generator) Describe() []FieldInfo {
+	result := make([]FieldInfo, 0, len(g.fields))
+
+	for _, name := range g.order {
+		info := FieldInfo{Name: name, Origin: g.Type(), Hidden: g.hidden[name]}
+		field := g.fields[name]
+
+		for ref, isRef := field.(*ReferenceField); isRef; ref, isRef = field.(*ReferenceField) {
+			info.Inherited, info.Origin = true, ref.referred.Type()
+			field = ref.referred.fields[ref.fieldName]
+		}
+
+		if entity, isEntity := field.(*EntityField); isEntity {
+			types := make([]string, 0, 1)
+			for _, alternative := range entity.entityGenerator.Alternatives() {
+				types = append(types, alternative.Type())
 			}
+			info.Type = strings.Join(types, " | ")
+		} else if field.Type() == "float" {
+			info.Type = "decimal" // as it's spelled in specs
+		} else {
+			info.Type = field.Type()
+		}
 
-			if !field.Multiple() {
-				entity[name] = field.GenerateValue()
-			} else {
-				amount := field.Amount()
-				values := make([]interface{}, amount)
-				for i := 0; i < amount; i++ {
-					values[i] = field.GenerateValue()
-				}
-				entity[name] = values
+		result = append(result, info)
+	}
+
+	return result
+}
+
+/**
+ * Lays out an entity's resolved fields like a definition, noting where inherited
+ * fields come from, and which fields are hidden:
+ *
+ * Employee {
+ *   age   decimal
+ *   name  string  # from Person
+ *   salt  string  # hidden
+ * }
+ */
+func (g *Generator) Outline(name string) string {
+	fields := g.Describe()
+	width := 0
+
+	for _, f := range fields {
+		if len(f.Name) > width {
+			width = len(f.Name)
+		}
+	}
+
+	lines := []string{fmt.Sprintf("%s {", name)}
+	if g.abstract {
+		lines[0] = "abstract " + lines[0]
+	}
+
+	for _, f := range fields {
+		line := fmt.Sprintf("  %-*s  %s", width, f.Name, f.Type)
+		notes := make([]string, 0, 2)
+		if f.Inherited {
+			notes = append(notes, "from "+f.Origin)
+		}
+		if f.Hidden {
+			notes = append(notes, "hidden")
+		}
+		if len(notes) > 0 {
+			line += "  # " + strings.Join(notes, ", ")
+		}
+		lines = append(lines, line)
+	}
+
+	return strings.Join(append(lines, "}"), "\n")
+}
+
+// an entity nested within another through one of its fields, including inherited ones
+type Nesting struct {
+	Field    string
+	Entity   *Generator
+	Optional bool // true when the field may not nest the entity at all, e.g. friends Person[0, 3]
+}
+
+func (g *Generator) Nestings() []Nesting {
+	result := make([]Nesting, 0)
+
+	for _, name := range g.order {
+		field := g.fields[name]
+
+		if ref, isRef := field.(*ReferenceField); isRef {
+			field = ref.referencedField()
+		}
+
+		if entity, isEntity := field.(*EntityField); isEntity {
+			optional := nil != entity.Bound && entity.Min == 0 // [0] and [0, 0] nest nothing at all
+
+			for _, alternative := range entity.entityGenerator.Alternatives() {
+				result = append(result, Nesting{Field: name, Entity: alternative, Optional: optional})
 			}
 		}
-		entities[i] = entity
 	}
-	return entities
+
+	return result
 }
 
-func (g *Generator) String() string {
-	return fmt.Sprintf("%s{}", g.name)
+// a chain of nested entities that leads back to where it started
+type Cycle struct {
+	Root   *Generator // the entity from which the cycle was found
+	Entity *Generator // the entity that nests itself
+	Path   []string   // each step as Entity.field, ending with the entity's name
 }
 
-func sortKeys(fields FieldSet) []string {
-	keys := make([]string, 0, len(fields))
-	for key := range fields {
-		keys = append(keys, key)
+/**
+ * Finds the entities that nest themselves through fields that always generate a
+ * value, so that their nesting never ends on its own; optional fields like
+ * friends Person[0, 3] eventually stop, so they don't count. Each cycle is only
+ * reported once, from the first root that reaches it.
+ */
+func Cycles(roots ...*Generator) []Cycle {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	result := make([]Cycle, 0)
+	state := make(map[*Generator]int)
+	stack := make([]*Generator, 0)
+	path := make([]string, 0)
+
+	var visit func(g, root *Generator)
+
+	visit = func(g, root *Generator) {
+		state[g] = visiting
+		stack = append(stack, g)
+
+		for _, nesting := range g.Nestings() {
+			if nesting.Optional {
+				continue
+			}
+
+			step := g.Type() + "." + nesting.Field
+
+			switch state[nesting.Entity] {
+			case unvisited:
+				path = append(path, step)
+				visit(nesting.Entity, root)
+				path = path[:len(path)-1]
+			case visiting:
+				start := 0
+				for idx, ancestor := range stack {
+					if ancestor == nesting.Entity {
+						start = idx
+					}
+				}
+
+				cycle := append(append([]string{}, path[start:]...), step, nesting.Entity.Type())
+				result = append(result, Cycle{Root: root, Entity: nesting.Entity, Path: cycle})
+			}
+		}
+
+		stack = stack[:len(stack)-1]
+		state[g] = visited
 	}
-	sort.Strings(keys)
-	return keys
+
+	for _, root := range roots {
+		if state[root] == unvisited {
+			visit(root, root)
+		}
+	}
+
+	return result
+}
+
+func (g *Generator) String() string {
+	return fmt.Sprintf("%s{}", g.name)
 }
@@ -1,10 +1,12 @@
 package generator
 
 import (
+	"encoding/json"
 	"fmt"
 	. "github.com/ThoughtWorksStudios/bobcat/test_helpers"
 	"github.com/satori/go.uuid"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 	. "github.com/ThoughtWorksStudios/bobcat/common"
@@ -49,6 +51,204 @@ func TestExtendGenerator(t *testing.T) {
 	AssertEqual(t, "h00man", extended["species"])
 	AssertEqual(t, "kyle", extended["name"].(string))
 	Assert(t, isBetween(extended["age"].(float64), 2, 4), "extended entity failed to generate the correct age")
+	AssertEqual(t, "thing", extended["$extends"])
+}
+
+func TestExtendGeneratorWithSeveralParents(t *testing.T) {
+	logger := GetLogger(t)
+	content := NewGenerator("Content", logger)
+	content.WithStaticField("title", "post")
+	content.WithStaticField("status", "draft")
+
+	timestamps := NewGenerator("Timestamps", logger)
+	timestamps.WithStaticField("status", "published")
+	timestamps.WithStaticField("createdAt", "today")
+
+	auditable := ExtendGenerator("Auditable", timestamps)
+	auditable.WithStaticField("auditor", "ann")
+
+	post := ExtendGenerator("Post", content, auditable)
+	post.WithStaticField("title", "mine")
+
+	AssertEqual(t, "[Content Auditable Timestamps]", fmt.Sprintf("%v", post.ancestors))
+	AssertEqual(t, "[title status createdAt auditor]", fmt.Sprintf("%v", post.order))
+
+	entity := post.Generate(1)[0]
+	AssertEqual(t, "mine", entity["title"])
+	AssertEqual(t, "published", entity["status"], "later parents should override earlier ones")
+	AssertEqual(t, "today", entity["createdAt"])
+	AssertEqual(t, "ann", entity["auditor"])
+	AssertEqual(t, "[Content Auditable Timestamps]", fmt.Sprintf("%v", entity["$extends"]))
+	AssertEqual(t, "Timestamps", auditable.Generate(1)[0]["$extends"], "a single parent should keep $extends a plain type")
+}
+
+func TestExcludedFieldsAreNotInherited(t *testing.T) {
+	g := NewGenerator("User", GetLogger(t))
+	g.WithStaticField("name", "ann")
+	g.WithStaticField("password", "secret")
+	g.WithStaticField("email", "ann@example.com")
+
+	m := ExtendGenerator("PublicUser", g)
+	AssertNil(t, m.WithoutField("password"), "Should be able to exclude an inherited field")
+	ExpectsError(t, `PublicUser has no inherited field "password" to exclude`, m.WithoutField("password"))
+
+	m.WithStaticField("nick", "a")
+	ExpectsError(t, `PublicUser has no inherited field "nick" to exclude`, m.WithoutField("nick"))
+
+	AssertEqual(t, "[name email nick]", fmt.Sprintf("%v", m.order))
+	_, hasPassword := m.Generate(1)[0]["password"]
+	Assert(t, !hasPassword, "Excluded fields should not be generated")
+	AssertEqual(t, "secret", g.Generate(1)[0]["password"])
+}
+
+func TestHiddenFieldsAreGeneratedButLeftOut(t *testing.T) {
+	pet := NewGenerator("Pet", GetLogger(t))
+	g := NewGenerator("User", GetLogger(t))
+	g.WithStaticField("salt", "pepper")
+	g.WithEntityField("pet", pet, nil, nil)
+	AssertNil(t, g.HideField("salt"), "Should be able to hide a field")
+	AssertNil(t, g.HideField("pet"), "Should be able to hide a field")
+	ExpectsError(t, `User has no field "$id" to hide`, g.HideField("$id"))
+
+	m := ExtendGenerator("Account", g)
+	m.WithStaticField("pet", "none")
+
+	user := g.Generate(1)[0]
+	AssertEqual(t, 3, len(user))
+	AssertEqual(t, "[{Name:salt Type:literal Inherited:true Origin:User Hidden:true} {Name:pet Type:literal Inherited:false Origin:Account Hidden:false}]", fmt.Sprintf("%+v", m.Describe()))
+	AssertEqual(t, "none", m.Generate(1)[0]["pet"])
+}
+
+func TestStructsAreNestedAsPlainObjects(t *testing.T) {
+	pet := NewGenerator("Pet", GetLogger(t))
+	address := NewStruct(GetLogger(t))
+	address.WithStaticField("city", "Chicago")
+	address.WithEntityField("pet", pet, nil, nil)
+
+	g := NewGenerator("Person", GetLogger(t))
+	g.WithEntityField("address", address, nil, nil)
+	g.WithEntityField("previous", address, nil, &Bound{Min: 2, Max: 2})
+
+	person := g.Generate(1)[0]
+	nested := person["address"].(EntityResult)
+	AssertEqual(t, 2, len(nested), "Expected no metadata, but got %v", nested)
+	AssertEqual(t, "Chicago", nested["city"])
+	AssertEqual(t, person["$id"], nested["pet"].(map[string]GeneratedEntities)["Pet"][0]["$parent"], "Expected entities nested in a struct to be children of the entity around it")
+	AssertEqual(t, 2, len(person["previous"].([]interface{})))
+
+	encoded, err := json.Marshal(Compile(g).Ordered(person))
+	AssertNil(t, err, "Didn't expect to get an error: %v", err)
+	Assert(t, strings.Contains(string(encoded), `"address":{"city":"Chicago","pet":{"Pet":[`), "Expected the struct's fields in order, but got %s", encoded)
+}
+
+func TestOnlyTheEntityMarkedAbstractIsAbstract(t *testing.T) {
+	g := NewGenerator("Mammal", GetLogger(t)).SetAbstract(true)
+	g.WithStaticField("legs", 4)
+	m := ExtendGenerator("Dog", g)
+
+	Assert(t, g.Abstract(), "Expected Mammal to be abstract")
+	Assert(t, !m.Abstract(), "Extensions of abstract entities should be concrete")
+	AssertEqual(t, "abstract Mammal {\n  legs  literal\n}", g.Outline("Mammal"))
+}
+
+func TestDescribeResolvesInheritedFields(t *testing.T) {
+	g := NewGenerator("Person", GetLogger(t))
+	g.WithField("name", "string", 10, nil)
+	g.WithField("age", "integer", [2]int{1, 10}, nil)
+
+	pet := NewGenerator("Pet", GetLogger(t))
+	g.WithEntityField("pet", pet, nil, nil)
+
+	m := ExtendGenerator("Employee", g)
+	m.WithField("age", "decimal", [2]float64{18, 65}, nil)
+
+	expected := []FieldInfo{
+		{Name: "name", Type: "string", Inherited: true, Origin: "Person"},
+		{Name: "age", Type: "decimal", Inherited: false, Origin: "Employee"},
+		{Name: "pet", Type: "Pet", Inherited: true, Origin: "Person"},
+	}
+
+	AssertEqual(t, fmt.Sprintf("%v", expected), fmt.Sprintf("%v", m.Describe()))
+}
+
+func TestNestingsIncludeInheritedEntityFields(t *testing.T) {
+	pet := NewGenerator("Pet", GetLogger(t))
+	g := NewGenerator("Person", GetLogger(t))
+	g.WithField("name", "string", 10, nil)
+	g.WithEntityField("pet", pet, nil, nil)
+
+	m := ExtendGenerator("Employee", g)
+	m.WithEntityField("friends", g, nil, &Bound{Min: 0, Max: 3})
+	m.WithEntityField("boss", g, nil, &Bound{Min: 0, Max: 0})
+
+	nestings := m.Nestings()
+	AssertEqual(t, 3, len(nestings))
+	AssertEqual(t, Nesting{Field: "pet", Entity: pet, Optional: false}, nestings[0])
+	AssertEqual(t, Nesting{Field: "friends", Entity: g, Optional: true}, nestings[1])
+	AssertEqual(t, Nesting{Field: "boss", Entity: g, Optional: true}, nestings[2], "Expected [0, 0] to never nest")
+}
+
+func TestCyclesOnlyIncludeFieldsThatAlwaysNest(t *testing.T) {
+	person := NewGenerator("Person", GetLogger(t))
+	pet := NewGenerator("Pet", GetLogger(t))
+	person.WithEntityField("pet", pet, nil, nil)
+	pet.WithEntityField("owner", person, nil, nil)
+	person.WithEntityField("friends", person, nil, &Bound{Min: 0, Max: 3})
+
+	cycles := Cycles(person, pet)
+	AssertEqual(t, 1, len(cycles))
+	AssertEqual(t, person, cycles[0].Root)
+	AssertEqual(t, person, cycles[0].Entity)
+	AssertEqual(t, "Person.pet -> Pet.owner -> Person", strings.Join(cycles[0].Path, " -> "))
+
+	AssertEqual(t, 0, len(Cycles(NewGenerator("Lonely", GetLogger(t)))))
+}
+
+func nestingDepth(entity EntityResult, field string) int {
+	depth := 0
+	for nested, ok := entity[field].(map[string]GeneratedEntities); ok; nested, ok = entity[field].(map[string]GeneratedEntities) {
+		entity = nested["Person"][0]
+		depth++
+	}
+	return depth
+}
+
+func TestGenerateCutsOffSelfNestingWithNull(t *testing.T) {
+	g := NewGenerator("Person", GetLogger(t))
+	g.WithEntityField("friend", g, nil, nil)
+	g.WithEntityField("enemies", g, nil, &Bound{Min: 1, Max: 1})
+
+	entity := g.GenerateLimited(1, NestingLimit{MaxDepth: 3, Truncate: TruncateWithNull})[0]
+	AssertEqual(t, 2, nestingDepth(entity, "friend"))
+
+	deepest := entity["friend"].(map[string]GeneratedEntities)["Person"][0]["friend"].(map[string]GeneratedEntities)["Person"][0]
+	Assert(t, nil == deepest["friend"], "Expected the friend beyond the maximum depth to be null, but got %v", deepest["friend"])
+	AssertEqual(t, 0, len(deepest["enemies"].([]interface{})))
+}
+
+func TestGenerateCutsOffSelfNestingWithReference(t *testing.T) {
+	g := NewGenerator("Person", GetLogger(t))
+	g.WithEntityField("friend", g, nil, nil)
+	g.WithEntityField("enemies", g, nil, &Bound{Min: 1, Max: 1})
+
+	entity := g.GenerateLimited(1, NestingLimit{MaxDepth: 1, Truncate: TruncateWithReference})[0]
+	AssertEqual(t, entity["$id"], entity["friend"])
+	AssertEqual(t, fmt.Sprintf("%v", []interface{}{entity["$id"]}), fmt.Sprintf("%v", entity["enemies"]))
+}
+
+func TestGenerateUsesDefaultNestingLimitForInheritedFields(t *testing.T) {
+	g := NewGenerator("Person", GetLogger(t))
+	g.WithEntityField("friend", g, nil, nil)
+	m := ExtendGenerator("Employee", g)
+
+	entity := m.Generate(1)[0]
+	AssertEqual(t, DefaultNestingLimit().MaxDepth, nestingDepth(entity, "friend"))
+}
+
+func TestNestingLimitValidation(t *testing.T) {
+	AssertNil(t, DefaultNestingLimit().Validate(), "Default limit should be valid")
+	ExpectsError(t, "Maximum nesting depth must be at least 1, but was 0", NestingLimit{MaxDepth: 0, Truncate: TruncateWithNull}.Validate())
+	ExpectsError(t, `Unknown truncation "drop"; expected "null" or "reference"`, NestingLimit{MaxDepth: 2, Truncate: "drop"}.Validate())
 }
 
 func TestSubentityHasParentReference(t *testing.T) {
@@ -68,6 +268,9 @@ func TestSubentityHasParentReference(t *testing.T) {
 	if person_id != cat_parent {
 		t.Errorf("Parent id (%v) on subentity does not match the parent entity's id (%v)", cat_parent, person_id)
 	}
+
+	_, hasParent := subentityGenerator.Generate(1)[0]["$parent"]
+	Assert(t, !hasParent, "Entities generated on their own should not refer to the last parent that nested them")
 }
 
 func TestWithFieldCreatesCorrectFields(t *testing.T) {
@@ -142,10 +345,35 @@ func TestWithStaticFieldCreatesCorrectField(t *testing.T) {
 	}
 }
 
+func TestStaticArraysAndObjectsAreNotShared(t *testing.T) {
+	g := NewGenerator("thing", GetLogger(t))
+	g.WithStaticField("config", map[string]interface{}{"tags": []interface{}{"a", "b"}})
+
+	entities := g.Generate(2)
+	first := entities[0]["config"].(map[string]interface{})
+	first["tags"].([]interface{})[0] = "changed"
+
+	AssertEqual(t, "a", entities[1]["config"].(map[string]interface{})["tags"].([]interface{})[0])
+}
+
+func TestPickFieldPicksOneOfItsValues(t *testing.T) {
+	g := NewGenerator("thing", GetLogger(t))
+	AssertNil(t, g.WithField("color", "pick", []interface{}{"red", "green"}, nil), "Didn't expect an error")
+	ExpectsError(t, "expected field args to be a non-empty array for field shade (pick), but got []", g.WithField("shade", "pick", []interface{}{}, nil))
+
+	seen := make(map[interface{}]bool)
+	for _, entity := range g.Generate(50) {
+		seen[entity["color"]] = true
+	}
+
+	AssertEqual(t, 2, len(seen))
+	Assert(t, seen["red"] && seen["green"], "Expected to pick both colors, but got %v", seen)
+}
+
 func TestWithEntityFieldCreatesCorrectField(t *testing.T) {
 	logger := GetLogger(t)
 	g := NewGenerator("thing", logger)
-	bound := &Bound{3, 3}
+	bound := &Bound{Min: 3, Max: 3}
 	g.WithEntityField("food", g, 3, bound)
 	expectedField := &EntityField{g, bound}
 	if !equiv(expectedField, g.fields["food"]) {
@@ -232,12 +460,12 @@ func TestGenerateWithBoundsArgumentProducesCorrectAmountOfValues(t *testing.T) {
 	g := NewGenerator("thing", logger)
 	timeMin, _ := time.Parse("2006-01-02", "1945-01-01")
 	timeMax, _ := time.Parse("2006-01-02", "1945-01-02")
-	g.WithField("a", "string", 2, &Bound{2,2})
-	g.WithField("b", "integer", [2]int{2, 4}, &Bound{3,3})
-	g.WithField("c", "decimal", [2]float64{2.85, 4.50}, &Bound{4,4})
-	g.WithField("d", "date", [2]time.Time{timeMin, timeMax}, &Bound{5,5})
-	g.WithField("e", "dict", "last_name", &Bound{6,6})
-	g.WithEntityField("f", NewGenerator("subthing", logger), 1, &Bound{7,7})
+	g.WithField("a", "string", 2, &Bound{Min: 2, Max: 2})
+	g.WithField("b", "integer", [2]int{2, 4}, &Bound{Min: 3, Max: 3})
+	g.WithField("c", "decimal", [2]float64{2.85, 4.50}, &Bound{Min: 4, Max: 4})
+	g.WithField("d", "date", [2]time.Time{timeMin, timeMax}, &Bound{Min: 5, Max: 5})
+	g.WithField("e", "dict", "last_name", &Bound{Min: 6, Max: 6})
+	g.WithEntityField("f", NewGenerator("subthing", logger), 1, &Bound{Min: 7, Max: 7})
 
 	data = g.Generate(1)
 
@@ -259,3 +487,140 @@ func TestGenerateWithBoundsArgumentProducesCorrectAmountOfValues(t *testing.T) {
 		AssertEqual(t, field.amount, actual)
 	}
 }
+
+func TestGenerateIntoIsRepeatableForAnyNumberOfWorkers(t *testing.T) {
+	pet := NewGenerator("Pet", GetLogger(t))
+	pet.WithField("color", "dict", "colors", nil)
+
+	g := NewGenerator("Person", GetLogger(t))
+	g.WithField("name", "dict", "full_names", nil)
+	g.WithField("age", "integer", [2]int{1, 90}, nil)
+	g.WithEntityField("pets", pet, 1, &Bound{Min: 1, Max: 3})
+
+	generate := func(workers int) GeneratedEntities {
+		result, batches := NewGeneratedEntities(0), 0
+
+		err := g.GenerateInto(2*BatchSize+10, Options{Nesting: DefaultNestingLimit(), Workers: workers, Seed: 42}, func(batch GeneratedEntities) error {
+			result, batches = result.Concat(batch), batches+1
+			return nil
+		})
+
+		AssertNil(t, err, "Didn't expect an error: %v", err)
+		AssertEqual(t, 3, batches)
+		return result
+	}
+
+	expected := generate(1)
+	AssertEqual(t, 2*BatchSize+10, len(expected))
+
+	for _, workers := range []int{2, 4, 7} {
+		Assert(t, reflect.DeepEqual(expected, generate(workers)), "Expected %d workers to generate the same entities as one", workers)
+	}
+
+	AssertEqual(t, expected[0]["$id"], expected[0]["pets"].([]interface{})[0].(map[string]GeneratedEntities)["Pet"][0]["$parent"])
+}
+
+func TestGenerateIntoStopsAtFirstEmitError(t *testing.T) {
+	g := NewGenerator("Person", GetLogger(t))
+	batches := 0
+
+	err := g.GenerateInto(100*BatchSize, Options{Nesting: DefaultNestingLimit(), Workers: 4, Seed: 1}, func(batch GeneratedEntities) error {
+		batches++
+		if batches == 2 {
+			return fmt.Errorf("disk full")
+		}
+		return nil
+	})
+
+	ExpectsError(t, "disk full", err)
+	AssertEqual(t, 2, batches)
+}
+
+func TestCompiledPlansResolveInheritedFieldsAndIgnoreLaterChanges(t *testing.T) {
+	g := NewGenerator("Person", GetLogger(t))
+	g.WithField("nicknames", "string", 4, &Bound{Min: 2, Max: 2})
+	g.WithStaticField("species", "human")
+
+	plan := Compile(ExtendGenerator("Employee", g))
+	g.WithStaticField("species", "robot")
+
+	AssertEqual(t, "Employee", plan.Type())
+
+	var entity EntityResult
+	plan.GenerateInto(1, Options{Nesting: DefaultNestingLimit(), Workers: 1, Seed: 1}, func(batch GeneratedEntities) error {
+		entity = batch[0]
+		return nil
+	})
+
+	AssertEqual(t, "human", entity["species"])
+	AssertEqual(t, 2, len(entity["nicknames"].([]interface{})))
+}
+
+func TestUnionsGenerateEachEntityFromOneOfTheirAlternatives(t *testing.T) {
+	payment := NewGenerator("Payment", GetLogger(t)).SetAbstract(true)
+	payment.WithStaticField("amount", 10)
+
+	card := ExtendGenerator("CreditCard", payment)
+	card.WithStaticField("number", "4111")
+	transfer := ExtendGenerator("BankTransfer", payment)
+	transfer.WithStaticField("iban", "DE00")
+
+	union := NewUnion([]*Generator{card, transfer}, []int{3, 1})
+	AssertEqual(t, "Payment", union.Type())
+	AssertEqual(t, "CreditCard|Robot", NewUnion([]*Generator{card, NewGenerator("Robot", nil)}, []int{1, 1}).Type())
+
+	plan := Compile(union)
+	counts := make(map[interface{}]int)
+
+	plan.GenerateInto(400, Options{Nesting: DefaultNestingLimit(), Workers: 1, Seed: 1}, func(batch GeneratedEntities) error {
+		for _, entity := range batch {
+			counts[entity["$type"]]++
+
+			encoded, _ := json.Marshal(plan.Ordered(entity))
+			Assert(t, strings.HasSuffix(string(encoded), `"amount":10,"number":"4111"}`) || strings.HasSuffix(string(encoded), `"amount":10,"iban":"DE00"}`), "Expected the fields of the alternative, in order, but got %s", encoded)
+		}
+		return nil
+	})
+
+	AssertEqual(t, 400, counts["CreditCard"]+counts["BankTransfer"])
+	Assert(t, counts["CreditCard"] > 2*counts["BankTransfer"], "Expected about 3 credit cards to each bank transfer, but got %v", counts)
+}
+
+func TestUnionFieldsNestOneOfTheirAlternatives(t *testing.T) {
+	person := NewGenerator("Person", GetLogger(t))
+	robot := NewGenerator("Robot", GetLogger(t))
+	g := NewGenerator("Team", GetLogger(t))
+	g.WithEntityField("lead", NewUnion([]*Generator{person, robot}, []int{1, 1}), nil, nil)
+
+	AssertEqual(t, "[{Name:lead Type:Person | Robot Inherited:false Origin:Team Hidden:false}]", fmt.Sprintf("%+v", g.Describe()))
+	AssertEqual(t, Nesting{Field: "lead", Entity: person, Optional: false}, g.Nestings()[0])
+	AssertEqual(t, Nesting{Field: "lead", Entity: robot, Optional: false}, g.Nestings()[1])
+
+	lead := g.Generate(1)[0]["lead"].(map[string]GeneratedEntities)
+	AssertEqual(t, 1, len(lead))
+
+	for entityType, entities := range lead {
+		AssertEqual(t, entityType, entities[0]["$type"])
+	}
+}
+
+func TestRecursiveUnionsAreCutOffAtTheMaximumDepth(t *testing.T) {
+	node := NewGenerator("Node", GetLogger(t))
+	leaf := NewGenerator("Leaf", GetLogger(t))
+	node.WithEntityField("next", NewUnion([]*Generator{node, node}, []int{1, 1}), nil, nil)
+	node.WithEntityField("more", NewUnion([]*Generator{node, leaf}, []int{100000000, 1}), nil, &Bound{Min: 2, Max: 2})
+
+	Assert(t, len(Cycles(node)) > 0, "Expected a union whose alternatives nest the entity to be an endless cycle")
+
+	root := node.GenerateLimited(1, NestingLimit{MaxDepth: 2, Truncate: TruncateWithNull})[0]
+	child := root["next"].(map[string]GeneratedEntities)["Node"][0]
+	AssertNil(t, child["next"], "Expected the union to be cut off at depth 2")
+
+	for _, value := range child["more"].([]interface{}) {
+		_, isLeaf := value.(map[string]GeneratedEntities)["Leaf"]
+		Assert(t, isLeaf, "Expected only leaves below the maximum depth, but got %v", value)
+	}
+
+	root = node.GenerateLimited(1, NestingLimit{MaxDepth: 1, Truncate: TruncateWithReference})[0]
+	AssertEqual(t, root["$id"], root["next"])
+}
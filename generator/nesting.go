@@ -0,0 +1,100 @@
+package generator
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// what replaces entities that would nest deeper than a NestingLimit allows
+const (
+	TruncateWithNull      = "null"      // null, or an empty array for multi-value fields
+	TruncateWithReference = "reference" // the $id of the closest ancestor of the same type
+)
+
+/**
+ * Bounds how deeply an entity may nest itself, e.g. a Person with a Person
+ * `friend` field, which would otherwise recurse forever
+ */
+type NestingLimit struct {
+	MaxDepth int    // how many levels of the same entity may be nested within each other
+	Truncate string // one of TruncateWithNull or TruncateWithReference
+}
+
+func DefaultNestingLimit() NestingLimit {
+	return NestingLimit{MaxDepth: 5, Truncate: TruncateWithNull}
+}
+
+func (limit NestingLimit) Validate() error {
+	if limit.MaxDepth < 1 {
+		return fmt.Errorf("Maximum nesting depth must be at least 1, but was %d", limit.MaxDepth)
+	}
+
+	if limit.Truncate != TruncateWithNull && limit.Truncate != TruncateWithReference {
+		return fmt.Errorf("Unknown truncation %q; expected %q or %q", limit.Truncate, TruncateWithNull, TruncateWithReference)
+	}
+
+	return nil
+}
+
+type ancestor struct {
+	plan   *Plan
+	entity EntityResult
+}
+
+// the state of a single call to Generate() (or of one batch of a parallel run), shared with the entities it nests
+type generation struct {
+	limit     NestingLimit
+	rng       *rand.Rand
+	ancestors []ancestor // the entities currently being generated, outermost first
+}
+
+func (run *generation) enter(p *Plan, entity EntityResult) {
+	run.ancestors = append(run.ancestors, ancestor{plan: p, entity: entity})
+}
+
+func (run *generation) leave() {
+	run.ancestors = run.ancestors[:len(run.ancestors)-1]
+}
+
+// the entity that nests the one being generated, if any
+func (run *generation) parent() EntityResult {
+	if len(run.ancestors) < 2 {
+		return nil
+	}
+	return run.ancestors[len(run.ancestors)-2].entity
+}
+
+func (run *generation) depth(p *Plan) int {
+	depth := 0
+	for _, a := range run.ancestors {
+		if a.plan == p {
+			depth++
+		}
+	}
+	return depth
+}
+
+// with -truncate=reference, the $id of the closest ancestor generated by the plan; otherwise nil
+func (run *generation) reference(p *Plan) interface{} {
+	if run.limit.Truncate == TruncateWithReference {
+		for idx := len(run.ancestors) - 1; idx >= 0; idx-- {
+			if a := run.ancestors[idx]; a.plan == p {
+				return a.entity["$id"]
+			}
+		}
+	}
+	return nil
+}
+
+func (run *generation) truncate(s step) interface{} {
+	value := run.reference(s.nested)
+
+	if !s.field.Multiple() {
+		return value
+	}
+
+	if nil == value {
+		return []interface{}{}
+	}
+	return []interface{}{value}
+}
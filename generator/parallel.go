@@ -0,0 +1,130 @@
+package generator
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// how many entities are generated at a time by a single worker
+const BatchSize = 1000
+
+// how a run of GenerateInto() is carried out
+type Options struct {
+	Nesting NestingLimit
+	Workers int   // how many goroutines generate batches at once; less than 2 generates them on the calling goroutine
+	Seed    int64 // the same seed always produces the same entities, regardless of the number of workers
+}
+
+// compiles the generator and generates from its plan; see Plan.GenerateInto()
+func (g *Generator) GenerateInto(count int64, opts Options, emit func(GeneratedEntities) error) error {
+	return Compile(g).GenerateInto(count, opts, emit)
+}
+
+/**
+ * Generates count entities in batches of up to BatchSize, handing each batch to
+ * emit in order as soon as it (and every batch before it) is done, so that runs
+ * of any size can be written out without keeping them in memory.
+ *
+ * Each batch draws from its own random stream, seeded from opts.Seed and the
+ * batch's position, so batches may be generated by several workers at once and
+ * still come out the same. At most a few batches per worker are held while they
+ * wait their turn. Generation stops at the first error that emit returns.
+ */
+func (p *Plan) GenerateInto(count int64, opts Options, emit func(GeneratedEntities) error) error {
+	batches := (count + BatchSize - 1) / BatchSize
+
+	if opts.Workers < 2 || batches < 2 {
+		for index := int64(0); index < batches; index++ {
+			if err := emit(p.generateBatch(index, count, opts)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	type batch struct {
+		index  int64
+		result chan GeneratedEntities
+	}
+
+	pending := make(chan batch, 2*opts.Workers) // in order; bounds how far workers may run ahead of emit
+	jobs := make(chan batch)
+	stop := make(chan struct{})
+
+	go func() {
+		defer close(jobs)
+		defer close(pending)
+
+		for index := int64(0); index < batches; index++ {
+			b := batch{index: index, result: make(chan GeneratedEntities, 1)}
+
+			select {
+			case pending <- b:
+			case <-stop:
+				return
+			}
+
+			select {
+			case jobs <- b:
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	var workers sync.WaitGroup
+
+	for w := 0; w < opts.Workers; w++ {
+		workers.Add(1)
+
+		go func() {
+			defer workers.Done()
+
+			for b := range jobs {
+				b.result <- p.generateBatch(b.index, count, opts)
+			}
+		}()
+	}
+
+	var err error
+
+	for b := range pending {
+		if nil == err {
+			if err = emit(<-b.result); nil != err {
+				close(stop)
+			}
+		}
+	}
+
+	workers.Wait()
+	return err
+}
+
+// the index-th batch of a run of count entities
+func (p *Plan) generateBatch(index, count int64, opts Options) GeneratedEntities {
+	size := count - index*BatchSize
+	if size > BatchSize {
+		size = BatchSize
+	}
+
+	return p.generate(size, &generation{limit: opts.Nesting, rng: rand.New(rand.NewSource(batchSeed(opts.Seed, index)))})
+}
+
+// spreads consecutive batches far apart, so that their streams don't resemble each other (splitmix64)
+func batchSeed(seed, index int64) int64 {
+	z := uint64(seed) + uint64(index+1)*0x9E3779B97F4A7C15
+	z = (z ^ (z >> 30)) * 0xBF58476D1CE4E5B9
+	z = (z ^ (z >> 27)) * 0x94D049BB133111EB
+	return int64(z ^ (z >> 31))
+}
+
+var seedLock sync.Mutex
+var seeds = rand.New(rand.NewSource(time.Now().UnixNano()))
+
+// a seed for runs that weren't given one; distinct even when runs start at the same moment
+func randomSeed() int64 {
+	seedLock.Lock()
+	defer seedLock.Unlock()
+	return seeds.Int63()
+}
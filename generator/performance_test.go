@@ -1,6 +1,7 @@
 package generator
 
 import (
+	. "github.com/ThoughtWorksStudios/bobcat/common"
 	"testing"
 )
 
@@ -116,3 +117,33 @@ func BenchmarkGenerateOneMillionWithTwoEntityFields(b *testing.B) {
 
 	resetTimerAndGenerateX(b, generator, 1000000)
 }
+
+func BenchmarkGenerateOneHundredThousandWithInheritedFields(b *testing.B) {
+	generator := ExtendGenerator("Employee", ExtendGenerator("Person", setup(b)))
+	generator.WithField("salary", "integer", [2]int{1000, 9000}, nil)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		generator.Generate(100000)
+	}
+}
+
+func BenchmarkCompileWithNestedEntities(b *testing.B) {
+	generator := NewGenerator("Person", nil)
+	generator.WithEntityField("pet", setup(b), 1, nil)
+	generator.WithEntityField("friends", generator, 1, &Bound{Min: 0, Max: 3})
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Compile(generator)
+	}
+}
+
+func BenchmarkGenerateIntoOneHundredThousandWithFourWorkers(b *testing.B) {
+	plan := Compile(setup(b))
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		plan.GenerateInto(100000, Options{Nesting: DefaultNestingLimit(), Workers: 4, Seed: 1}, func(GeneratedEntities) error { return nil })
+	}
+}
@@ -0,0 +1,279 @@
+package generator
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+/**
+ * An entity's generator compiled for generating: inherited fields are resolved to
+ * the fields that declare them, the order in which fields are generated is worked
+ * out once, and nested entities are compiled along with it. A Plan never changes
+ * once compiled, even if its generator does, so it may be shared between workers.
+ */
+type Plan struct {
+	entityType string
+	steps      []step
+	hidden     []string // fields that are generated, then removed from the entity
+	plain      bool     // a struct's, which isn't an entity of its own
+
+	species      string  // tells apart the alternatives of a union that have the same type
+	alternatives []*Plan // a union's, one of which generates each entity
+	weights      []int
+	totalWeight  int
+}
+
+// one field of a plan; nested is set for fields that generate entities
+type step struct {
+	name   string
+	field  Field
+	nested *Plan
+}
+
+func Compile(g *Generator) *Plan {
+	return compile(g, make(map[*Generator]*Plan))
+}
+
+// plans are shared between the fields that nest the same generator, which also ends self-nesting
+func compile(g *Generator, plans map[*Generator]*Plan) *Plan {
+	if p, compiled := plans[g]; compiled {
+		return p
+	}
+
+	p := &Plan{entityType: g.Type(), species: g.name, plain: g.plain}
+	plans[g] = p
+
+	if len(g.alternatives) > 0 {
+		p.alternatives, p.weights = make([]*Plan, len(g.alternatives)), g.weights
+
+		for idx, alternative := range g.alternatives {
+			p.alternatives[idx] = compile(alternative, plans)
+			p.totalWeight += g.weights[idx]
+		}
+		return p
+	}
+
+	names := g.fieldNames() // $id must be generated before any nested entity refers to it
+	p.steps = make([]step, len(names))
+
+	for idx, name := range names {
+		s := step{name: name, field: resolveField(g.fields[name])}
+
+		if entity, isEntity := s.field.(*EntityField); isEntity {
+			s.nested = compile(entity.entityGenerator, plans)
+		}
+
+		p.steps[idx] = s
+
+		if g.hidden[name] {
+			p.hidden = append(p.hidden, name)
+		}
+	}
+
+	return p
+}
+
+func (p *Plan) Type() string {
+	return p.entityType
+}
+
+// picks one of a union's alternatives, in proportion to its weight
+func (p *Plan) pick(run *generation) *Plan {
+	n := run.rng.Intn(p.totalWeight)
+
+	for idx, weight := range p.weights {
+		if n < weight {
+			return p.alternatives[idx]
+		}
+		n -= weight
+	}
+	return p.alternatives[len(p.alternatives)-1]
+}
+
+func (p *Plan) generate(count int64, run *generation) GeneratedEntities {
+	entities := NewGeneratedEntities(count)
+
+	if len(p.alternatives) > 0 {
+		for i := range entities {
+			entities[i] = p.pick(run).generate(1, run)[0]
+		}
+		return entities
+	}
+
+	for i := range entities {
+		entity := make(EntityResult, len(p.steps)+1) // room for $parent
+
+		if !p.plain { // a struct is part of the entity around it, so it has no parent of its own
+			run.enter(p, entity)
+
+			if parent := run.parent(); nil != parent {
+				entity["$parent"] = parent["$id"]
+			}
+		}
+
+		for _, s := range p.steps {
+			entity[s.name] = s.generate(run)
+		}
+
+		if !p.plain {
+			run.leave()
+		}
+
+		for _, name := range p.hidden { // only once the nested entities are done with it
+			delete(entity, name)
+		}
+
+		entities[i] = entity
+	}
+
+	return entities
+}
+
+/**
+ * A nested entity, as it appears in its parent; a union's is keyed by the type of
+ * the alternative it picked, and a struct's is the bare object
+ */
+func (p *Plan) nest(run *generation) interface{} {
+	if len(p.alternatives) > 0 {
+		return p.pick(run).nest(run)
+	}
+
+	if p.plain {
+		return p.generate(1, run)[0]
+	}
+	return map[string]GeneratedEntities{p.entityType: p.generate(1, run)}
+}
+
+func (s step) generate(run *generation) interface{} {
+	if nil != s.nested && len(s.nested.alternatives) == 0 && run.depth(s.nested) >= run.limit.MaxDepth {
+		return run.truncate(s)
+	}
+
+	if !s.field.Multiple() {
+		value, _ := s.value(run)
+		return value
+	}
+
+	amount := s.field.Amount(run.rng)
+	values := make([]interface{}, 0, amount)
+	for i := 0; i < amount; i++ {
+		if value, cut := s.value(run); !cut || nil != value { // cut off values are left out, unless they refer to an ancestor
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+/**
+ * A union picks its alternative for each value, so it is only then that it can
+ * tell whether the value is nested too deeply and must be cut off
+ */
+func (s step) value(run *generation) (interface{}, bool) {
+	if nil == s.nested {
+		return s.field.GenerateValue(run.rng), false
+	}
+
+	plan := s.nested
+	for len(plan.alternatives) > 0 {
+		plan = plan.pick(run)
+	}
+
+	if run.depth(plan) >= run.limit.MaxDepth {
+		return run.reference(plan), true
+	}
+	return plan.nest(run), false
+}
+
+/**
+ * Wraps an entity generated by this plan so that it is written to JSON with its
+ * fields in the plan's order (metadata first, then the order they were declared)
+ * instead of alphabetically, as maps are; nested entities are ordered too
+ */
+func (p *Plan) Ordered(entity EntityResult) json.Marshaler {
+	for _, alternative := range p.alternatives {
+		if entity["$species"] == alternative.species {
+			return alternative.Ordered(entity)
+		}
+	}
+	return orderedEntity{plan: p, entity: entity}
+}
+
+type orderedEntity struct {
+	plan   *Plan
+	entity EntityResult
+}
+
+func (e orderedEntity) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+
+	write := func(name string, value interface{}) error {
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+
+		key, _ := json.Marshal(name)
+		buf.Write(key)
+		buf.WriteByte(':')
+
+		encoded, err := json.Marshal(value)
+		buf.Write(encoded)
+		return err
+	}
+
+	parent, hasParent := e.entity["$parent"]
+
+	for _, s := range e.plan.steps {
+		if hasParent && !strings.HasPrefix(s.name, "$") {
+			if err := write("$parent", parent); err != nil {
+				return nil, err
+			}
+			hasParent = false
+		}
+
+		if value, ok := e.entity[s.name]; ok {
+			if err := write(s.name, s.ordered(value)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if hasParent {
+		if err := write("$parent", parent); err != nil {
+			return nil, err
+		}
+	}
+
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// nested entities are generated as {"Type": [entity]} (structs as bare objects), or an array of those for multi-value fields
+func (s step) ordered(value interface{}) interface{} {
+	if nil == s.nested {
+		return value
+	}
+
+	switch v := value.(type) {
+	case EntityResult:
+		return s.nested.Ordered(v)
+	case map[string]GeneratedEntities:
+		result := make(map[string][]json.Marshaler, len(v))
+		for entityType, entities := range v {
+			result[entityType] = make([]json.Marshaler, len(entities))
+			for idx, entity := range entities {
+				result[entityType][idx] = s.nested.Ordered(entity)
+			}
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for idx, nested := range v {
+			result[idx] = s.ordered(nested)
+		}
+		return result
+	}
+
+	return value // a truncated entity
+}
@@ -0,0 +1,84 @@
+package interpreter
+
+import (
+	"github.com/ThoughtWorksStudios/bobcat/dsl"
+	"strings"
+)
+
+// collects multiple errors so that a check can report everything wrong with a spec at once
+type ErrorList []error
+
+func (el ErrorList) Error() string {
+	messages := make([]string, len(el))
+	for i, err := range el {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+// appends err, flattening any nested ErrorList
+func (el ErrorList) add(err error) ErrorList {
+	if nested, ok := err.(ErrorList); ok {
+		return append(el, nested...)
+	}
+	return append(el, err)
+}
+
+// avoids returning a non-nil error interface wrapping an empty list; a single
+// error is returned as-is
+func (el ErrorList) asError() error {
+	switch len(el) {
+	case 0:
+		return nil
+	case 1:
+		return el[0]
+	default:
+		return el
+	}
+}
+
+// locates err at node, unless err is a list of errors that were already located individually.
+// errors from the generator package are the result of inverted ranges (e.g. `integer(10, 1)`).
+func wrapErr(node dsl.Node, err error) error {
+	switch err.(type) {
+	case ErrorList:
+		return err
+	case *dsl.Diagnostic:
+		return node.WrapErr(err)
+	default:
+		return node.CodedErr(dsl.CodeInvalidRange, "%v", err)
+	}
+}
+
+// formats each error with its source snippet, one after another
+func RenderErrors(err error) string {
+	list, ok := err.(ErrorList)
+
+	if !ok {
+		return dsl.Render(err)
+	}
+
+	rendered := make([]string, len(list))
+	for i, e := range list {
+		rendered[i] = dsl.Render(e)
+	}
+	return strings.Join(rendered, "\n\n")
+}
+
+// flattens err into a list of diagnostics, e.g. for machine-readable output
+func Diagnostics(err error) []*dsl.Diagnostic {
+	if nil == err {
+		return []*dsl.Diagnostic{}
+	}
+
+	list, ok := err.(ErrorList)
+	if !ok {
+		list = ErrorList{err}
+	}
+
+	result := make([]*dsl.Diagnostic, len(list))
+	for i, e := range list {
+		result[i] = dsl.AsDiagnostic(e)
+	}
+	return result
+}
@@ -36,5 +36,9 @@ func basedir(path, basepath string) (string, error) {
 		return fs.Dir(path), nil
 	}
 
+	if fs.IsAbs(basepath) {
+		return fs.Join(basepath, fs.Dir(path)), nil
+	}
+
 	return fs.Rel(".", fs.Join(basepath, fs.Dir(path)))
 }
@@ -3,9 +3,15 @@ package interpreter
 import (
 	"fmt"
 	. "github.com/ThoughtWorksStudios/bobcat/common"
+	"github.com/ThoughtWorksStudios/bobcat/dictionary"
 	"github.com/ThoughtWorksStudios/bobcat/dsl"
 	"github.com/ThoughtWorksStudios/bobcat/generator"
+	"github.com/ThoughtWorksStudios/bobcat/logging"
+	"io"
+	"math"
+	"math/rand"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -13,17 +19,13 @@ import (
 
 // Might be useful to pull these out into another file
 var UNIX_EPOCH time.Time
-var NOW time.Time
 
 func init() {
 	UNIX_EPOCH, _ = time.Parse("2006-01-02", "1970-01-01")
-	NOW = time.Now()
 }
 
 type NamespaceCounter map[string]int
 
-var AnonExtendNames NamespaceCounter = make(NamespaceCounter)
-
 func (c NamespaceCounter) Next(key string) int {
 	if ctr, hasKey := c[key]; hasKey {
 		ctr += 1
@@ -40,19 +42,157 @@ func (c NamespaceCounter) NextAsStr(key string) string {
 }
 
 type Interpreter struct {
-	basedir string
-	output  GenerationOutput
+	basedir    string
+	output     GenerationOutput
+	dryRun     bool
+	nesting    generator.NestingLimit
+	logger     logging.ILogger
+	dictionary *dictionary.Dictionary
+	now        time.Time        // the default upper bound for date fields
+	anonymous  NamespaceCounter // numbers the names given to anonymous entities
+	workers    int
+	sortFields bool                // write fields alphabetically, rather than in the order they were declared
+	seeds      *rand.Rand          // seeds each generate statement in turn
+	stream     *OutputStream       // when set, receives generated entities instead of output
+	parameters map[string]dsl.Node // replace the values of `let` statements with the same names
+	assigned   map[string]bool     // the parameters that replaced a `let` statement's value
+	scale      float64             // multiplies the count of every generate statement
 }
 
 func New() *Interpreter {
 	return &Interpreter{
-		output:  GenerationOutput{},
-		basedir: ".",
+		output:     GenerationOutput{},
+		basedir:    ".",
+		nesting:    generator.DefaultNestingLimit(),
+		logger:     &logging.DefaultLogger{},
+		dictionary: dictionary.New(""),
+		now:        time.Now(),
+		anonymous:  make(NamespaceCounter),
+		workers:    1,
+		seeds:      rand.New(rand.NewSource(time.Now().UnixNano())),
+		parameters: make(map[string]dsl.Node),
+		assigned:   make(map[string]bool),
+		scale:      1,
+	}
+}
+
+// how many goroutines each generate statement may use
+func (i *Interpreter) SetWorkers(workers int) error {
+	if workers < 1 {
+		return fmt.Errorf("The number of workers must be at least 1, but was %d", workers)
+	}
+
+	i.workers = workers
+	return nil
+}
+
+func (i *Interpreter) SetSortFields(sorted bool) {
+	i.sortFields = sorted
+}
+
+// makes generated entities repeatable: the same spec and seed produce the same output
+func (i *Interpreter) SetSeed(seed int64) {
+	i.seeds = rand.New(rand.NewSource(seed))
+}
+
+/**
+ * Replaces the value of `let name = ...` with value, so that the same spec can
+ * generate, say, 10 users in a smoke test and 10 million in a load test. The
+ * value is written as it would be in a `let` statement, except that anything
+ * else, such as a bare word (e.g. eu), is taken to be a string.
+ */
+func (i *Interpreter) SetParameter(name, value string) error {
+	parameter, err := parseParameter(name, value)
+
+	if err != nil || parameter.Kind == "identifier" {
+		parameter, err = parseParameter(name, strconv.Quote(value))
+	}
+
+	if err != nil {
+		return fmt.Errorf("Cannot set %q; parameters are named like any identifier, e.g. users=100", name)
+	}
+
+	i.parameters[name] = parameter
+	return nil
+}
+
+// the value of `let name = value`, which must be the only statement
+func parseParameter(name, value string) (dsl.Node, error) {
+	parsed, err := parseReader("-set "+name, strings.NewReader(fmt.Sprintf("let %s = %s", name, value)))
+	if err != nil {
+		return dsl.Node{}, err
+	}
+
+	if statements := parsed.(dsl.Node).Children; len(statements) == 1 && statements[0].Kind == "let" {
+		return statements[0].ValNode(), nil
+	}
+	return dsl.Node{}, fmt.Errorf("Expected a single value, but got %q", value)
+}
+
+// the parameters set so far that no `let` statement has used, e.g. because of a typo
+func (i *Interpreter) UnassignedParameters() []string {
+	result := make([]string, 0)
+
+	for name := range i.parameters {
+		if !i.assigned[name] {
+			result = append(result, name)
+		}
+	}
+
+	sort.Strings(result)
+	return result
+}
+
+// multiplies the count of every generate statement, which is rounded, but never below 1
+func (i *Interpreter) SetScale(scale float64) error {
+	if scale <= 0 {
+		return fmt.Errorf("The scale must be greater than 0, but was %v", scale)
+	}
+
+	i.scale = scale
+	return nil
+}
+
+// entities generated from now on are written to the stream as they are generated
+func (i *Interpreter) StreamTo(stream *OutputStream) {
+	i.stream = stream
+}
+
+// warnings found while loading a spec are reported through the logger
+func (i *Interpreter) SetLogger(logger logging.ILogger) {
+	i.logger = logger
+}
+
+// loggers that also implement this are given warnings as they are, e.g. to show them in an editor, rather than rendered as text
+type DiagnosticLogger interface {
+	WarnDiagnostic(w *dsl.Diagnostic)
+}
+
+func (i *Interpreter) warn(w *dsl.Diagnostic) {
+	if logger, ok := i.logger.(DiagnosticLogger); ok {
+		logger.WarnDiagnostic(w)
+	} else {
+		i.logger.Warn("%s", dsl.Render(w))
 	}
 }
 
+func (i *Interpreter) SetNestingLimit(limit generator.NestingLimit) error {
+	if err := limit.Validate(); err != nil {
+		return err
+	}
+
+	i.nesting = limit
+	return nil
+}
+
+// only affects entities that are defined afterward
 func (i *Interpreter) SetCustomDictonaryPath(path string) {
-	generator.CustomDictPath = path
+	i.dictionary = dictionary.New(path)
+}
+
+// dict() fields only use the embedded dictionaries, rather than also looking in the working directory
+func (i *Interpreter) UseBuiltinDictionaries() {
+	i.dictionary = dictionary.Builtin()
 }
 
 func (i *Interpreter) WriteGeneratedContent(dest string, filePerEntity bool) error {
@@ -63,6 +203,16 @@ func (i *Interpreter) WriteGeneratedContent(dest string, filePerEntity bool) err
 	}
 }
 
+// writes, then forgets, whatever was generated since the last call; writes nothing if there wasn't anything
+func (i *Interpreter) FlushGeneratedContent(out io.Writer) error {
+	if len(i.output) == 0 {
+		return nil
+	}
+
+	defer func() { i.output = GenerationOutput{} }()
+	return i.output.encode(out)
+}
+
 func (i *Interpreter) LoadFile(filename string, scope *Scope) error {
 	original := i.basedir
 	realpath, re := resolve(filename, original)
@@ -100,9 +250,58 @@ func (i *Interpreter) LoadFile(filename string, scope *Scope) error {
 	}
 }
 
+/**
+ * Like LoadFile(), but reads the spec from r instead of the file system (e.g. an unsaved
+ * editor buffer). The filename is still used for error locations and to resolve imports.
+ */
+func (i *Interpreter) LoadReader(filename string, r io.Reader, scope *Scope) error {
+	original := i.basedir
+
+	if base, e := basedir(filename, original); e == nil {
+		i.basedir = base
+		defer func() { i.basedir = original }()
+	} else {
+		return e
+	}
+
+	if parsed, pe := parseReader(filename, r); pe == nil {
+		scope.imports.MarkSeen(filename) // best effort; the file may not exist on disk yet
+		return i.Visit(parsed.(dsl.Node), scope)
+	} else {
+		return pe
+	}
+}
+
+/**
+ * Runs the full interpreter pass over a file (imports, scope resolution, field
+ * construction) without generating any entities. Unlike generation, this does
+ * not halt at the first bad statement so that all errors are reported at once.
+ */
 func (i *Interpreter) CheckFile(filename string) error {
-	_, errors := parseFile(filename)
-	return errors
+	i.dryRun = true
+	defer func() { i.dryRun = false }()
+
+	return i.LoadFile(filename, NewRootScope())
+}
+
+// the LoadReader() counterpart to CheckFile(); the scope is populated with the checked definitions
+func (i *Interpreter) CheckReader(filename string, r io.Reader, scope *Scope) error {
+	i.dryRun = true
+	defer func() { i.dryRun = false }()
+
+	return i.LoadReader(filename, r, scope)
+}
+
+func (i *Interpreter) validateDictionary(category dsl.Node) error {
+	if err := assertValStr(category); err != nil {
+		return err
+	}
+
+	if err := i.dictionary.ValidateCategory(valStr(category)); err != nil {
+		return category.CodedErr(dsl.CodeUnknownDictionary, "%v", err)
+	}
+
+	return nil
 }
 
 /**
@@ -119,25 +318,51 @@ func parseFile(filename string) (interface{}, error) {
 		err = f.Close()
 	}()
 
-	return dsl.ParseReader(filename, f, dsl.GlobalStore("filename", filename))
+	return parseReader(filename, f)
+}
+
+func parseReader(filename string, r io.Reader) (interface{}, error) {
+	ast, err := dsl.ParseReader(filename, r, dsl.GlobalStore("filename", filename))
+
+	if err != nil {
+		return ast, ErrorList(dsl.ParseErrors(filename, err)).asError()
+	}
+
+	return ast, nil
 }
 
 func (i *Interpreter) Visit(node dsl.Node, scope *Scope) error {
 	switch node.Kind {
 	case "root":
-		var err error
+		errors := ErrorList{}
+
+		// only for the rest of this walk, so that later loads on the same interpreter still generate
+		dryRun := i.dryRun
+		defer func() { i.dryRun = dryRun }()
+
 		node.Children.Each(func(env *dsl.IterEnv, node dsl.Node) {
-			if err = i.Visit(node, scope); err != nil {
-				env.Halt()
+			if err := i.Visit(node, scope); err != nil {
+				errors = errors.add(err)
+
+				// generated output is useless once there is an error, so just keep checking the
+				// remaining statements in order to report as many errors as possible in one run
+				i.dryRun = true
 			}
 		})
-		return err
+		return errors.asError()
 	case "entity":
 		_, err := i.EntityFromNode(node, scope)
 		return err
 	case "generation":
 		return i.GenerateFromNode(node, scope)
+	case "let":
+		return i.LetFromNode(node, scope)
+	case "template":
+		return i.TemplateFromNode(node, scope)
 	case "import":
+		if _, e := resolve(node.ValStr(), i.basedir); e != nil {
+			return node.CodedErr(dsl.CodeImportFailed, "Cannot import %q: %v", node.ValStr(), e)
+		}
 		return i.LoadFile(node.ValStr(), scope)
 	default:
 		return node.Err("Unexpected token type %s", node.Kind)
@@ -153,11 +378,11 @@ func (i *Interpreter) defaultArgumentFor(fieldType string) (interface{}, error)
 	case "decimal":
 		return [2]float64{1, 10}, nil
 	case "date":
-		return [2]time.Time{UNIX_EPOCH, NOW}, nil
-	case "entity", "identifier":
+		return [2]time.Time{UNIX_EPOCH, i.now}, nil
+	case "entity", "identifier", "union":
 		return 1, nil
 	default:
-		return nil, fmt.Errorf("Field of type `%s` requires arguments", fieldType)
+		return nil, dsl.NewError(dsl.CodeInvalidArguments, "Field of type `%s` requires arguments", fieldType)
 	}
 }
 
@@ -170,32 +395,88 @@ func (i *Interpreter) EntityFromNode(node dsl.Node, scope *Scope) (*generator.Ge
 	formalName := node.Name
 
 	if node.HasRelation() {
-		symbol := node.Related.ValStr()
-		if parent, e := i.ResolveEntity(*node.Related, scope); nil == e {
+		parents := make([]*generator.Generator, 0, len(node.Mixins)+1)
 
-			if formalName == "" {
-				formalName = strings.Join([]string{"$" + AnonExtendNames.NextAsStr(symbol), symbol}, "::")
+		for _, ref := range node.Parents() {
+			if parent, e := i.resolveEntityRef(ref, ref.Args, scope); nil == e {
+				parents = append(parents, parent)
+			} else if nil != scope.ResolveSymbol(ref.ValStr()) {
+				return nil, e // e.g. a template instantiated with the wrong arguments
+			} else {
+				return nil, node.CodedErr(dsl.CodeUnresolvedSymbol, "Cannot resolve parent entity %q for entity %q", ref.ValStr(), formalName)
 			}
+		}
 
-			entity = generator.ExtendGenerator(formalName, parent)
-		} else {
-			return nil, node.Err("Cannot resolve parent entity %q for entity %q", symbol, formalName)
+		if formalName == "" {
+			symbol := node.Related.ValStr()
+			formalName = strings.Join([]string{"$" + i.anonymous.NextAsStr(symbol), symbol}, "::")
 		}
+
+		entity = generator.ExtendGenerator(formalName, parents...).WithDictionary(i.dictionary)
 	} else {
 		if formalName == "" {
-			formalName = "$" + AnonExtendNames.NextAsStr("$")
+			formalName = "$" + i.anonymous.NextAsStr("$")
 		}
-		entity = generator.NewGenerator(formalName, nil)
+		entity = generator.NewGenerator(formalName, nil).WithDictionary(i.dictionary)
 	}
 
+	entity.SetAbstract(node.Abstract)
+
 	// Add entity to symbol table before iterating through field defs so fields can reference
 	// the current entity. Currently, though, this will be problematic as we don't have a nullable
 	// option for fields. The workaround is to inline override.
 	parentScope.SetSymbol(formalName, "entity", entity)
 
-	for _, field := range node.Children {
+	if err := i.withFields(entity, node.Children, scope); err != nil {
+		return nil, err
+	}
+
+	i.warnEndlessNesting(entity, node)
+	return entity, nil
+}
+
+/**
+ * A cycle is complete once the last of its entities is defined, so only the cycles
+ * that lead back to the entity just defined are new; the others have been reported
+ * already. Checking here, rather than when generating, warns about every spec that
+ * is loaded, whether or not it has generate statements.
+ */
+func (i *Interpreter) warnEndlessNesting(entity *generator.Generator, node dsl.Node) {
+	for _, cycle := range generator.Cycles(entity) {
+		if cycle.Entity == entity {
+			w := dsl.NewWarning(dsl.CodeEndlessNesting, "Entity %q nests itself without end (%s), so it will be cut off after %d levels", cycle.Entity.Type(), strings.Join(cycle.Path, " -> "), i.nesting.MaxDepth)
+			w.Ref = node.Ref
+			i.warn(w)
+		}
+	}
+}
+
+// a struct's fields are declared just like an entity's, but it has no name or parents
+func (i *Interpreter) StructFromNode(node dsl.Node, scope *Scope) (*generator.Generator, error) {
+	nested := generator.NewStruct(nil).WithDictionary(i.dictionary)
+
+	if err := i.withFields(nested, node.Children, ExtendScope(scope)); err != nil {
+		return nil, err
+	}
+
+	return nested, nil
+}
+
+// keeps going after a bad field declaration so that all of them are reported
+func (i *Interpreter) withFields(entity *generator.Generator, fields dsl.NodeSet, scope *Scope) error {
+	errors := ErrorList{}
+
+	for _, field := range fields {
+		if field.Kind == "exclusion" {
+			if err := entity.WithoutField(field.Name); err != nil {
+				errors = errors.add(field.CodedErr(dsl.CodeInvalidField, "%v", err))
+			}
+			continue
+		}
+
 		if field.Kind != "field" {
-			return nil, field.Err("Expected a `field` declaration, but instead got `%s`", field.Kind) // should never get here
+			errors = errors.add(field.CodedErr(dsl.CodeInvalidField, "Expected a `field` declaration, but instead got `%s`", field.Kind)) // should never get here
+			continue
 		}
 
 		fieldType := field.ValNode().Kind
@@ -205,20 +486,130 @@ func (i *Interpreter) EntityFromNode(node dsl.Node, scope *Scope) (*generator.Ge
 			fallthrough
 		case "entity" == fieldType:
 			fallthrough
+		case "union" == fieldType:
+			fallthrough
+		case "struct" == fieldType:
+			fallthrough
 		case "builtin" == fieldType:
 			if err := i.withDynamicField(entity, field, scope); err != nil {
-				return nil, field.WrapErr(err)
+				errors = errors.add(wrapErr(field, err))
 			}
 		case strings.HasPrefix(fieldType, "literal-"):
 			if err := i.withStaticField(entity, field); err != nil {
-				return nil, field.WrapErr(err)
+				errors = errors.add(wrapErr(field, err))
 			}
 		default:
-			return nil, field.Err("Unexpected field type %s; field declarations must be either a built-in type or a literal value", fieldType)
+			errors = errors.add(field.CodedErr(dsl.CodeInvalidField, "Unexpected field type %s; field declarations must be either a built-in type or a literal value", fieldType))
+			continue
+		}
+
+		if field.Hidden {
+			entity.HideField(field.Name) // no harm done if the field failed to define
 		}
 	}
 
-	return entity, nil
+	return errors.asError()
+}
+
+/**
+ * Binds a name to a literal, a range, or a dictionary (e.g. `let ADULT_AGE = 18`) so that it
+ * may be used in place of them. Like entities, bindings are visible to the rest of the scope
+ * they are defined in, including entities defined within it and files that import it.
+ */
+func (i *Interpreter) LetFromNode(node dsl.Node, scope *Scope) error {
+	value := node.ValNode()
+
+	if parameter, set := i.parameters[node.Name]; set {
+		value, i.assigned[node.Name] = parameter, true
+	}
+
+	switch value.Kind {
+	case "identifier":
+		entry, err := i.ResolveIdentifier(value, scope)
+		if err != nil {
+			return err
+		}
+		scope.SetSymbol(node.Name, entry.Type, entry.Value)
+	case "range":
+		bounds, err := i.resolveArgs(value.Args, scope)
+		if err != nil {
+			return err
+		}
+
+		if len(bounds) != 2 {
+			return value.CodedErr(dsl.CodeInvalidArguments, "A range requires a min and a max, e.g. (18, 65), but %d values found.", len(bounds))
+		}
+
+		if bounds[0].Kind != bounds[1].Kind {
+			return value.CodedErr(dsl.CodeInvalidArguments, "The min and max of a range must be of the same type, but were %s and %s.", describeType(bounds[0]), describeType(bounds[1]))
+		}
+		scope.SetSymbol(node.Name, "range", bounds)
+	case "builtin":
+		args, err := i.resolveArgs(value.Args, scope)
+		if err != nil {
+			return err
+		}
+
+		if 0 == len(args) {
+			return value.CodedErr(dsl.CodeInvalidArguments, "Field of type `dict` requires arguments")
+		}
+
+		if err = expectsArgs(1, assertValStr, "dict", args); err == nil {
+			err = i.validateDictionary(args[0])
+		}
+
+		if err != nil {
+			return err
+		}
+		scope.SetSymbol(node.Name, "dict", valStr(args[0]))
+	default:
+		scope.SetSymbol(node.Name, "literal", value)
+	}
+
+	return nil
+}
+
+/**
+ * Replaces identifiers among args with the values bound to them by `let`; a range stands
+ * for both of its values, e.g. integer(AGES) is integer(18, 65) when AGES is (18, 65).
+ */
+func (i *Interpreter) resolveArgs(args dsl.NodeSet, scope *Scope) (dsl.NodeSet, error) {
+	if nil == args {
+		return nil, nil
+	}
+
+	resolved := make(dsl.NodeSet, 0, len(args))
+
+	for _, arg := range args {
+		if arg.Kind != "identifier" {
+			resolved = append(resolved, arg)
+			continue
+		}
+
+		entry, err := i.ResolveIdentifier(arg, scope)
+		if err != nil {
+			return nil, err
+		}
+
+		switch entry.Type {
+		case "literal":
+			resolved = append(resolved, usedAt(arg, entry.Value.(dsl.Node)))
+		case "range":
+			for _, bound := range entry.Value.(dsl.NodeSet) {
+				resolved = append(resolved, usedAt(arg, bound))
+			}
+		default:
+			return nil, arg.CodedErr(dsl.CodeTypeMismatch, "identifier %q should refer to a literal or a range, but instead was <type: %s, resolved: %v>", arg.ValStr(), entry.Type, entry.Value)
+		}
+	}
+
+	return resolved, nil
+}
+
+// a bound value, located where it is used so that errors about it point there
+func usedAt(use, value dsl.Node) dsl.Node {
+	value.Ref, value.Raw = use.Ref, use.Raw
+	return value
 }
 
 func valStr(n dsl.Node) string {
@@ -241,35 +632,42 @@ type Validator func(n dsl.Node) error
 
 func assertValStr(n dsl.Node) error {
 	if _, ok := n.Value.(string); !ok {
-		return n.Err("Expected %v to be a string, but was %T.", n.Value, n.Value)
+		return n.CodedErr(dsl.CodeInvalidArguments, "Expected %v to be a string, but was %T.", n.Value, n.Value)
 	}
 	return nil
 }
 
 func assertValInt(n dsl.Node) error {
 	if _, ok := n.Value.(int64); !ok {
-		return n.Err("Expected %v to be an integer, but was %T.", n.Value, n.Value)
+		return n.CodedErr(dsl.CodeInvalidArguments, "Expected %v to be an integer, but was %T.", n.Value, n.Value)
 	}
 	return nil
 }
 
 func assertValFloat(n dsl.Node) error {
 	if _, ok := n.Value.(float64); !ok {
-		return n.Err("Expected %v to be a decimal, but was %T.", n.Value, n.Value)
+		return n.CodedErr(dsl.CodeInvalidArguments, "Expected %v to be a decimal, but was %T.", n.Value, n.Value)
+	}
+	return nil
+}
+
+func assertValArray(n dsl.Node) error {
+	if _, ok := n.Value.([]interface{}); !ok {
+		return n.CodedErr(dsl.CodeInvalidArguments, "Expected %v to be an array, but was %T.", n.Value, n.Value)
 	}
 	return nil
 }
 
 func assertValTime(n dsl.Node) error {
 	if _, ok := n.Value.(time.Time); !ok {
-		return n.Err("Expected %v to be a datetime, but was %T.", n.Value, n.Value)
+		return n.CodedErr(dsl.CodeInvalidArguments, "Expected %v to be a datetime, but was %T.", n.Value, n.Value)
 	}
 	return nil
 }
 
 func expectsArgs(num int, fn Validator, fieldType string, args dsl.NodeSet) error {
 	if l := len(args); num != l {
-		return args[0].Err("Field type `%s` expected %d args, but %d found.", fieldType, num, l)
+		return args[0].CodedErr(dsl.CodeInvalidArguments, "Field type `%s` expected %d args, but %d found.", fieldType, num, l)
 	}
 
 	var er error
@@ -300,6 +698,14 @@ func (i *Interpreter) withDynamicField(entity *generator.Generator, field dsl.No
 		fieldType = fieldVal.Kind
 	}
 
+	if field.Args, err = i.resolveArgs(field.Args, scope); err != nil {
+		return err
+	}
+
+	if field.Bound, err = i.resolveArgs(field.Bound, scope); err != nil {
+		return err
+	}
+
 	var bound *Bound
 
 	if nil != field.Bound {
@@ -310,6 +716,31 @@ func (i *Interpreter) withDynamicField(entity *generator.Generator, field dsl.No
 		}
 	}
 
+	if fieldVal.Kind == "struct" {
+		if 0 != len(field.Args) {
+			return field.Args[0].CodedErr(dsl.CodeInvalidArguments, "A struct takes no arguments; give it a bound, e.g. [1, 3], for several of them")
+		}
+
+		if nested, e := i.StructFromNode(fieldVal, scope); e != nil {
+			return e
+		} else {
+			return entity.WithEntityField(field.Name, nested, 1, bound)
+		}
+	}
+
+	if fieldVal.Kind == "identifier" {
+		if entry := scope.ResolveSymbol(fieldVal.ValStr()); nil != entry && entry.Type == "template" {
+			// arguments instantiate the template, rather than setting how many entities to nest
+			if nested, e := i.instantiate(fieldVal, entry.Value.(*Template), field.Args, scope); e != nil {
+				return e
+			} else {
+				return entity.WithEntityField(field.Name, nested, 1, bound)
+			}
+		} else if nil != entry && entry.Type != "entity" {
+			return i.withBoundField(entity, field, entry, bound)
+		}
+	}
+
 	if 0 == len(field.Args) {
 		arg, e := i.defaultArgumentFor(fieldType)
 		if e != nil {
@@ -319,7 +750,7 @@ func (i *Interpreter) withDynamicField(entity *generator.Generator, field dsl.No
 				return entity.WithField(field.Name, fieldType, arg, bound)
 			}
 
-			if nested, e := i.expectEntity(fieldVal, scope); e != nil {
+			if nested, e := i.nestedEntity(field, scope); e != nil {
 				return e
 			} else {
 				return entity.WithEntityField(field.Name, nested, arg, bound)
@@ -342,29 +773,62 @@ func (i *Interpreter) withDynamicField(entity *generator.Generator, field dsl.No
 		}
 	case "dict":
 		if err = expectsArgs(1, assertValStr, fieldType, field.Args); err == nil {
-			return entity.WithField(field.Name, fieldType, valStr(field.Args[0]), bound)
+			if err = i.validateDictionary(field.Args[0]); err == nil {
+				return entity.WithField(field.Name, fieldType, valStr(field.Args[0]), bound)
+			}
 		}
 	case "date":
 		if err = expectsArgs(2, assertValTime, fieldType, field.Args); err == nil {
 			return entity.WithField(field.Name, fieldType, [2]time.Time{valTime(field.Args[0]), valTime(field.Args[1])}, bound)
 		}
-	case "identifier", "entity":
-		if nested, e := i.expectEntity(fieldVal, scope); e != nil {
+	case "pick":
+		if err = expectsArgs(1, assertValArray, fieldType, field.Args); err == nil {
+			if values := field.Args[0].Value.([]interface{}); len(values) > 0 {
+				return entity.WithField(field.Name, fieldType, values, bound)
+			}
+			err = field.Args[0].CodedErr(dsl.CodeInvalidArguments, "Field type `pick` needs an array with at least one element to pick from")
+		}
+	case "identifier", "entity", "union":
+		if nested, e := i.nestedEntity(field, scope); e != nil {
 			return e
-		} else {
-			/*
-			 * TODO: rethink args for entity types because it's not consistent with other types; here,
-			 * it serves as a way to generate multiple values, whereas in all other types it does not.
-			 * we should have a consistent syntax for creating multi-value fields
-			 */
-			if err = expectsArgs(1, assertValInt, "entity", field.Args); err == nil {
-				return entity.WithEntityField(field.Name, nested, valInt(field.Args[0]), bound)
+		} else if err = expectsArgs(1, assertValInt, "entity", field.Args); err == nil {
+			// an argument used to be how many entities to nest, before bounds did the same for every field type
+			w := dsl.NewWarning(dsl.CodeDeprecated, "Field %q nests %d entities by argument, which is deprecated; use a bound instead, e.g. [%d]", field.Name, valInt(field.Args[0]), valInt(field.Args[0]))
+			w.Ref = field.Args[0].Ref
+			i.warn(w)
+
+			if nil == bound {
+				if bound, err = i.validateFieldBound(field.Args); err != nil {
+					return field.Args[0].WrapErr(err)
+				}
 			}
+			return entity.WithEntityField(field.Name, nested, 1, bound)
 		}
 	}
 	return err
 }
 
+// a field declared with a name bound by `let`, e.g. `name NAMES` after `let NAMES = dict("full_names")`
+func (i *Interpreter) withBoundField(entity *generator.Generator, field dsl.Node, entry *ScopeEntry, bound *Bound) error {
+	ref := field.ValNode()
+	name := ref.ValStr()
+
+	switch entry.Type {
+	case "dict":
+		if 0 != len(field.Args) {
+			return field.Args[0].CodedErr(dsl.CodeInvalidArguments, "%q is a dictionary, so it takes no arguments", name)
+		}
+		return entity.WithField(field.Name, "dict", entry.Value.(string), bound)
+	case "literal":
+		if 0 != len(field.Args) || nil != field.Bound {
+			return field.CodedErr(dsl.CodeInvalidArguments, "%q is a literal value, so it takes no arguments or bound", name)
+		}
+		return entity.WithStaticField(field.Name, entry.Value.(dsl.Node).Value)
+	default:
+		return ref.CodedErr(dsl.CodeTypeMismatch, "identifier %q should refer to an entity, a literal, or a dictionary, but instead was <type: %s, resolved: %v>", name, entry.Type, entry.Value)
+	}
+}
+
 type nodeValidator struct {
 	err error
 }
@@ -382,44 +846,114 @@ func (i *Interpreter) validateFieldBound(bound dsl.NodeSet) (*Bound, error) {
 
 	switch boundArgs {
 	case 0:
-		return &Bound{1, 1}, nil
+		return &Bound{Min: 1, Max: 1}, nil
 	case 1:
 		validator.assertValidNode(bound[0], assertValInt)
 		if validator.err != nil {
 			return nil, validator.err
 		}
-		max := valInt(bound[0])
-		return &Bound{max, max}, nil
-	case 2:
+		count := valInt(bound[0])
+		if count < 0 {
+			return nil, dsl.NewError(dsl.CodeInvalidRange, "Field bound cannot be negative, but was '%v'", count)
+		}
+		return &Bound{Min: count, Max: count}, nil
+	case 2, 3:
 		validator.assertValidNode(bound[0], assertValInt)
 		validator.assertValidNode(bound[1], assertValInt)
+		if boundArgs == 3 {
+			validator.assertValidNode(bound[2], assertValStr)
+		}
 		if validator.err != nil {
 			return nil, validator.err
 		}
 		min, max := valInt(bound[0]), valInt(bound[1])
+		if min < 0 {
+			return nil, dsl.NewError(dsl.CodeInvalidRange, "Field bound cannot be negative, but was '%v'", min)
+		}
 		if max < min {
-			return nil, fmt.Errorf("Max '%v' cannot be less than min '%v'", max, min)
+			return nil, dsl.NewError(dsl.CodeInvalidRange, "Max '%v' cannot be less than min '%v'", max, min)
+		}
+		result := &Bound{Min: min, Max: max}
+		if boundArgs == 3 {
+			if result.Distribution = valStr(bound[2]); !IsDistribution(result.Distribution) {
+				return nil, dsl.NewError(dsl.CodeInvalidArguments, "Unknown distribution %q; expected one of %s", result.Distribution, strings.Join(Distributions, ", "))
+			}
 		}
-		return &Bound{min, max}, nil
+		return result, nil
 	default:
-		return nil, fmt.Errorf("Field bound must be one or two values only")
+		return nil, dsl.NewError(dsl.CodeInvalidArguments, "Field bound must be a count, or a min and max optionally followed by a distribution")
 	}
 }
 
+// abstract entities are only there to be extended, so a field may nest their extensions, but not them
+func (i *Interpreter) nestedEntity(field dsl.Node, scope *Scope) (*generator.Generator, error) {
+	ref := field.ValNode()
+	nested, err := i.expectEntity(ref, scope)
+
+	if err == nil && nested.Abstract() {
+		return nil, ref.CodedErr(dsl.CodeTypeMismatch, "Field %q nests %q, which is abstract, so only the entities that extend it may be nested", field.Name, nested.Type())
+	}
+	return nested, err
+}
+
 func (i *Interpreter) expectEntity(entityRef dsl.Node, scope *Scope) (*generator.Generator, error) {
 	switch entityRef.Kind {
 	case "identifier":
 		return i.ResolveEntity(entityRef, scope)
 	case "entity":
 		return i.EntityFromNode(entityRef, scope)
+	case "union":
+		return i.UnionFromNode(entityRef, scope)
 	default:
-		return nil, entityRef.Err("Expected an entity expression or reference, but got %q", entityRef.Kind)
+		return nil, entityRef.CodedErr(dsl.CodeTypeMismatch, "Expected an entity expression or reference, but got %q", entityRef.Kind)
+	}
+}
+
+// a union's alternatives must be entities that may be generated, with positive integer weights (1 by default)
+func (i *Interpreter) UnionFromNode(node dsl.Node, scope *Scope) (*generator.Generator, error) {
+	alternatives := make([]*generator.Generator, len(node.Children))
+	weights := make([]int, len(node.Children))
+
+	for idx, alternative := range node.Children {
+		ref := alternative.ValNode()
+		var err error
+
+		if ref.Kind == "entity" {
+			alternatives[idx], err = i.EntityFromNode(ref, scope)
+		} else {
+			alternatives[idx], err = i.resolveEntityRef(ref, ref.Args, scope)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if alternatives[idx].Abstract() {
+			return nil, ref.CodedErr(dsl.CodeTypeMismatch, "Entity %q is abstract, so it can't be one of a union's alternatives", alternatives[idx].Type())
+		}
+
+		weights[idx] = 1
+
+		if 0 != len(alternative.Args) {
+			args, err := i.resolveArgs(alternative.Args, scope)
+			if err != nil {
+				return nil, err
+			}
+
+			if assertValInt(args[0]) != nil || args[0].ValInt() < 1 {
+				return nil, args[0].CodedErr(dsl.CodeInvalidArguments, "The weight of a union's alternative must be a positive integer, but was %v", args[0].Value)
+			}
+
+			weights[idx] = int(args[0].ValInt())
+		}
 	}
+
+	return generator.NewUnion(alternatives, weights), nil
 }
 
 /*
- * A convenience wrapper for ResolveIdentifier, which casts to *generator.Generator. Currently, this
- * is the only type of value that is in the symbol table, but we may support other types in the future
+ * A convenience wrapper for ResolveIdentifier, which casts to *generator.Generator. The symbol
+ * table also holds the values bound by `let` statements, which are not entities.
  */
 func (i *Interpreter) ResolveEntity(identifierNode dsl.Node, scope *Scope) (*generator.Generator, error) {
 	if resolved, err := i.ResolveIdentifier(identifierNode, scope); err != nil {
@@ -428,7 +962,7 @@ func (i *Interpreter) ResolveEntity(identifierNode dsl.Node, scope *Scope) (*gen
 		if entity, ok := resolved.Value.(*generator.Generator); ok {
 			return entity, nil
 		} else {
-			return nil, identifierNode.Err("identifier %q should refer to an entity, but instead was <type: %s, resolved: %v>", identifierNode.ValStr(), resolved.Type, resolved.Value)
+			return nil, identifierNode.CodedErr(dsl.CodeTypeMismatch, "identifier %q should refer to an entity, but instead was <type: %s, resolved: %v>", identifierNode.ValStr(), resolved.Type, resolved.Value)
 		}
 	}
 }
@@ -446,7 +980,7 @@ func (i *Interpreter) ResolveIdentifier(identiferNode dsl.Node, scope *Scope) (*
 		return v, nil
 	}
 
-	return nil, identiferNode.Err("Cannot resolve symbol %q", identiferNode.ValStr())
+	return nil, identiferNode.CodedErr(dsl.CodeUnresolvedSymbol, "Cannot resolve symbol %q", identiferNode.ValStr())
 }
 
 func (i *Interpreter) GenerateFromNode(generationNode dsl.Node, scope *Scope) error {
@@ -455,7 +989,7 @@ func (i *Interpreter) GenerateFromNode(generationNode dsl.Node, scope *Scope) er
 	entity := generationNode.ValNode()
 	switch entity.Kind {
 	case "identifier":
-		if g, e := i.ResolveEntity(entity, scope); nil != e {
+		if g, e := i.resolveEntityRef(entity, entity.Args, scope); nil != e {
 			return e
 		} else {
 			entityGenerator = g
@@ -466,20 +1000,73 @@ func (i *Interpreter) GenerateFromNode(generationNode dsl.Node, scope *Scope) er
 		} else {
 			entityGenerator = g
 		}
+	case "union":
+		if g, e := i.UnionFromNode(entity, scope); e != nil {
+			return e
+		} else {
+			entityGenerator = g
+		}
 	default:
 		return generationNode.Err("Unexpected node type %q; node is %v", entity.Kind, entity)
 	}
 
+	if entityGenerator.Abstract() {
+		return entity.CodedErr(dsl.CodeInvalidGenerate, "Entity %q is abstract, so only the entities that extend it may be generated", entityGenerator.Type())
+	}
+
 	if 0 == len(generationNode.Args) {
-		return generationNode.Err("generate requires an argument")
+		return generationNode.CodedErr(dsl.CodeInvalidGenerate, "generate requires an argument")
 	}
 
-	count := generationNode.Args[0].ValInt()
+	args, err := i.resolveArgs(generationNode.Args, scope)
+	if err != nil {
+		return err
+	}
+
+	if len(args) != 1 || assertValInt(args[0]) != nil {
+		return args[0].CodedErr(dsl.CodeInvalidGenerate, "`generate` takes a non-zero integer count as its first argument")
+	}
+
+	count := args[0].ValInt()
 
 	if count < int64(1) {
-		return generationNode.Err("Must generate at least 1 %v entity", entityGenerator)
+		return generationNode.CodedErr(dsl.CodeInvalidGenerate, "Must generate at least 1 %v entity", entityGenerator)
+	}
+
+	if i.scale != 1 {
+		count = int64(math.Max(1, math.Floor(float64(count)*i.scale+0.5)))
 	}
 
-	i.output.addAndAppend(entityGenerator.Type(), entityGenerator.Generate(count))
+	if !i.dryRun {
+		return i.generate(generationNode, entityGenerator, count)
+	}
+	return nil
+}
+
+func (i *Interpreter) generate(node dsl.Node, entityGenerator *generator.Generator, count int64) error {
+	entityType, plan := entityGenerator.Type(), generator.Compile(entityGenerator)
+	opts := generator.Options{Nesting: i.nesting, Workers: i.workers, Seed: i.seeds.Int63()}
+
+	emit := func(entities generator.GeneratedEntities) error {
+		values := make([]interface{}, len(entities))
+		for idx, entity := range entities {
+			if i.sortFields {
+				values[idx] = entity
+			} else {
+				values[idx] = plan.Ordered(entity)
+			}
+		}
+
+		if nil != i.stream {
+			return i.stream.add(entityType, values)
+		}
+
+		i.output.addAndAppend(entityType, values)
+		return nil
+	}
+
+	if err := plan.GenerateInto(count, opts, emit); err != nil {
+		return node.Err("Cannot write generated %s entities: %v", entityType, err)
+	}
 	return nil
 }
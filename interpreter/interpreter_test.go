@@ -1,10 +1,14 @@
 package interpreter
 
 import (
+	"fmt"
 	. "github.com/ThoughtWorksStudios/bobcat/common"
 	"github.com/ThoughtWorksStudios/bobcat/dsl"
 	"github.com/ThoughtWorksStudios/bobcat/generator"
 	. "github.com/ThoughtWorksStudios/bobcat/test_helpers"
+	"path/filepath"
+	"sort"
+	"strings"
 	"testing"
 	"time"
 )
@@ -19,12 +23,22 @@ func AssertFieldYieldsValue(t *testing.T, entity *generator.Generator, field dsl
 	AssertEqual(t, field.ValNode().Value, result[field.Name])
 }
 
+// the fields a generated entity has, sorted
+func keys(entity generator.EntityResult) []string {
+	result := make([]string, 0, len(entity))
+	for name := range entity {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result
+}
+
 var validFields = dsl.NodeSet{
 	FieldNode("name", BuiltinNode("string"), IntArgs(10)...),
 	FieldNode("age", BuiltinNode("integer"), IntArgs(1, 10)...),
 	FieldNode("weight", BuiltinNode("decimal"), FloatArgs(1.0, 200.0)...),
 	FieldNode("dob", BuiltinNode("date"), DateArgs("2015-01-01", "2017-01-01")...),
-	FieldNode("last_name", BuiltinNode("dict"), StringArgs("last_name")...),
+	FieldNode("last_name", BuiltinNode("dict"), StringArgs("last_names")...),
 	FieldNode("catch_phrase", StringNode("Grass.... Tastes bad")),
 }
 
@@ -141,7 +155,7 @@ func TestValidateFieldBoundWithNoArguments(t *testing.T) {
 	bound := dsl.NodeSet{}
 
 	actual, _ := i.validateFieldBound(bound)
-	expected := Bound{1, 1}
+	expected := Bound{Min: 1, Max: 1}
 
 	AssertEqual(t, expected, *actual)
 }
@@ -151,7 +165,7 @@ func TestValidateFieldBoundWithOneValidArgument(t *testing.T) {
 	bound := IntArgs(3)
 
 	actual, _ := i.validateFieldBound(bound)
-	expected := Bound{3, 3}
+	expected := Bound{Min: 3, Max: 3}
 
 	AssertEqual(t, expected, *actual)
 }
@@ -170,7 +184,7 @@ func TestValidateFieldBoundWithTwoValidArguments(t *testing.T) {
 	bound := IntArgs(1, 3)
 
 	actual, _ := i.validateFieldBound(bound)
-	expected := Bound{1, 3}
+	expected := Bound{Min: 1, Max: 3}
 
 	AssertEqual(t, expected, *actual)
 }
@@ -195,11 +209,36 @@ func TestValidateFieldBoundWithMaxLargerThanMin(t *testing.T) {
 
 func TestValidateFieldBoundWithTooManyValidArguments(t *testing.T) {
 	i := interp()
-	bound := IntArgs(1, 2, 3)
+	bound := IntArgs(1, 2, 3, 4)
 
 	_, err := i.validateFieldBound(bound)
 
-	ExpectsError(t, "Field bound must be one or two values only", err)
+	ExpectsError(t, "Field bound must be a count, or a min and max optionally followed by a distribution", err)
+}
+
+func TestValidateFieldBoundWithDistribution(t *testing.T) {
+	i := interp()
+	bound := append(IntArgs(0, 5), StringArgs("geometric")...)
+
+	actual, err := i.validateFieldBound(bound)
+	AssertNil(t, err, "Didn't expect to get an error: %v", err)
+	AssertEqual(t, Bound{Min: 0, Max: 5, Distribution: "geometric"}, *actual)
+
+	_, err = i.validateFieldBound(append(IntArgs(0, 5), StringArgs("zipf")...))
+	ExpectsError(t, `Unknown distribution "zipf"; expected one of uniform, normal, geometric`, err)
+
+	_, err = i.validateFieldBound(IntArgs(1, 2, 3))
+	ExpectsError(t, "Expected 3 to be a string, but was int64.", err)
+}
+
+func TestValidateFieldBoundWithNegativeArguments(t *testing.T) {
+	i := interp()
+
+	_, err := i.validateFieldBound(IntArgs(-1))
+	ExpectsError(t, "Field bound cannot be negative, but was '-1'", err)
+
+	_, err = i.validateFieldBound(IntArgs(-2, 3))
+	ExpectsError(t, "Field bound cannot be negative, but was '-2'", err)
 }
 
 func TestInvalidGenerationNodeBadCountArg(t *testing.T) {
@@ -229,7 +268,7 @@ func TestDefaultArguments(t *testing.T) {
 		"string":  5,
 		"integer": [2]int{1, 10},
 		"decimal": [2]float64{1, 10},
-		"date":    [2]time.Time{UNIX_EPOCH, NOW},
+		"date":    [2]time.Time{UNIX_EPOCH, i.now},
 	}
 
 	for kind, expected_value := range defaults {
@@ -302,3 +341,506 @@ func TestValTime(t *testing.T) {
 	actual := valTime(DateArgs("1945-01-01")[0])
 	AssertEqual(t, expected, actual)
 }
+
+func TestConfiguringDictFieldWithUnknownDictionary(t *testing.T) {
+	i := interp()
+	testEntity := generator.NewGenerator("person", GetLogger(t))
+	badNode := FieldNode("name", BuiltinNode("dict"), StringArgs("first_name")...)
+	ExpectsError(t, `Unknown dictionary "first_name"`, i.withDynamicField(testEntity, badNode, NewRootScope()))
+}
+
+func TestCheckFileValidatesDictionaries(t *testing.T) {
+	path, _ := filepath.Abs("testdata/unknown_dictionary.lang")
+	expected := fmt.Sprintf(`%s:2:13 [byte 22] Unknown dictionary "first_name"`, path)
+	ExpectsError(t, expected, interp().CheckFile("testdata/unknown_dictionary.lang"))
+}
+
+func TestCheckFileReportsAllSemanticErrors(t *testing.T) {
+	err := interp().CheckFile("testdata/semantic_errors.lang")
+	errors, ok := err.(ErrorList)
+
+	Assert(t, ok, "Expected a list of errors, but got %v", err)
+	AssertEqual(t, 5, len(errors), "Expected all semantic errors to be reported, but got:\n%v", err)
+}
+
+func TestCheckFileDoesNotGenerate(t *testing.T) {
+	i := interp()
+	err := i.CheckFile("testdata/task_status_spec.lang")
+
+	AssertNil(t, err, "Didn't expect to get an error: %v", err)
+	AssertEqual(t, 0, len(i.output), "Check should not generate any entities")
+}
+
+func TestCheckFileResolvesImportsFromAbsolutePaths(t *testing.T) {
+	path, _ := filepath.Abs("testdata/imports_task.lang")
+	err := interp().CheckFile(path)
+	AssertNil(t, err, "Didn't expect to get an error: %v", err)
+}
+
+func TestCheckReaderPopulatesScope(t *testing.T) {
+	path, _ := filepath.Abs("testdata/unsaved.lang")
+	scope := NewRootScope()
+	err := interp().CheckReader(path, strings.NewReader(`import "task_status_spec.lang"
+
+Subtask: Task {}`), scope)
+
+	AssertNil(t, err, "Didn't expect to get an error: %v", err)
+	AssertNotNil(t, scope.ResolveSymbol("Task"), "Expected imported entities to be in scope")
+	AssertNotNil(t, scope.ResolveSymbol("Subtask"), "Expected declared entities to be in scope")
+}
+
+func TestLetBindingsStandInForTheirValues(t *testing.T) {
+	i := interp()
+	i.SetSortFields(true) // keeps the generated entities as they are
+	scope := NewRootScope()
+
+	err := i.LoadReader("let.lang", strings.NewReader(`let ADULT = 18
+let AGES = (ADULT, ADULT)
+let BORN = (1999-01-01, 1999-12-31)
+let NAMES = dict("first_names")
+let USERS = 3
+let NAME = NAMES
+
+Person: {
+  age   integer(AGES),
+  adult ADULT,
+  dob   date(BORN),
+  name  NAME,
+  nicks NAMES[USERS],
+  pets  { legs 4 }[ADULT, ADULT]
+}
+
+generate (USERS, Person)`), scope)
+	AssertNil(t, err, "Didn't expect to get an error: %v", err)
+
+	people := i.output["Person"]
+	AssertEqual(t, 3, len(people))
+
+	person := people[0].(generator.EntityResult)
+	AssertEqual(t, 18, person["age"])
+	AssertEqual(t, int64(18), person["adult"])
+	AssertEqual(t, 1999, person["dob"].(time.Time).Year())
+	AssertEqual(t, 3, len(person["nicks"].([]interface{})))
+	AssertEqual(t, 18, len(person["pets"].([]interface{})))
+	_, isString := person["name"].(string)
+	Assert(t, isString, "Expected name to be a dictionary entry")
+
+	AssertEqual(t, "literal", scope.ResolveSymbol("ADULT").Type)
+	AssertEqual(t, "range", scope.ResolveSymbol("AGES").Type)
+	AssertEqual(t, "dict", scope.ResolveSymbol("NAME").Type)
+}
+
+func TestLetBindingsAreScopedAndImportable(t *testing.T) {
+	path, _ := filepath.Abs("testdata/unsaved.lang")
+	scope := NewRootScope()
+
+	err := interp().CheckReader(path, strings.NewReader(`import "constants.lang"
+
+Task: { estimate integer(ESTIMATES), owner { sprint SPRINT } }
+generate (TASKS, Task)`), scope)
+	AssertNil(t, err, "Didn't expect to get an error: %v", err)
+
+	AssertNotNil(t, scope.ResolveSymbol("TASKS"), "Expected imported bindings to be in scope")
+
+	inner := scope.Extend()
+	inner.SetSymbol("TASKS", "literal", dsl.Node{Kind: "literal-int", Value: int64(2)})
+	AssertEqual(t, int64(2), inner.ResolveSymbol("TASKS").Value.(dsl.Node).Value)
+	AssertEqual(t, int64(5), scope.ResolveSymbol("TASKS").Value.(dsl.Node).Value)
+}
+
+func TestLetBindingsAreTypeCheckedWhereTheyAreUsed(t *testing.T) {
+	err := interp().CheckReader("let.lang", strings.NewReader(`let NAME = "Rick"
+let AGES = (1, "old")
+Person: { age integer(NAME, 3) }
+generate (NAME, Person)
+generate (Person, Person)`), NewRootScope())
+
+	diagnostics := Diagnostics(err)
+	AssertEqual(t, 4, len(diagnostics))
+
+	AssertEqual(t, dsl.CodeInvalidArguments, diagnostics[0].Code)
+	AssertEqual(t, "Expected Rick to be an integer, but was string.", diagnostics[1].Msg)
+	AssertEqual(t, 3, diagnostics[1].Ref.Line)
+	AssertEqual(t, 23, diagnostics[1].Ref.Col)
+	AssertEqual(t, dsl.CodeInvalidGenerate, diagnostics[2].Code)
+	AssertEqual(t, dsl.CodeTypeMismatch, diagnostics[3].Code)
+}
+
+func TestExcludedAndHiddenFieldsAreLeftOut(t *testing.T) {
+	i := interp()
+	i.SetSortFields(true) // keeps the generated entities as they are
+
+	err := i.LoadReader("users.lang", strings.NewReader(`User: {
+  name            "ann",
+  hidden salt     string(4),
+  password        "secret",
+  hidden          true
+}
+
+PublicUser: User { -password }
+Account: User { salt "shown", hidden password "x" }
+
+generate (1, User)
+generate (1, PublicUser)
+generate (1, Account)`), NewRootScope())
+	AssertNil(t, err, "Didn't expect to get an error: %v", err)
+
+	user := i.output["User"][0].(generator.EntityResult)
+	AssertEqual(t, "[$id $species $type hidden name password]", fmt.Sprintf("%v", keys(user)))
+
+	public := i.output["PublicUser"][0].(generator.EntityResult)
+	AssertEqual(t, "[$extends $id $species $type hidden name]", fmt.Sprintf("%v", keys(public)))
+
+	account := i.output["Account"][0].(generator.EntityResult)
+	AssertEqual(t, "[$extends $id $species $type hidden name salt]", fmt.Sprintf("%v", keys(account)))
+	AssertEqual(t, "shown", account["salt"])
+}
+
+func TestOnlyInheritedFieldsMayBeExcluded(t *testing.T) {
+	err := interp().CheckReader("users.lang", strings.NewReader(`User: { name "ann" }
+Admin: User { -name, -name, -age }
+Person: { -name }`), NewRootScope())
+
+	diagnostics := Diagnostics(err)
+	AssertEqual(t, 3, len(diagnostics))
+
+	AssertEqual(t, `Admin has no inherited field "name" to exclude`, diagnostics[0].Msg)
+	AssertEqual(t, 2, diagnostics[0].Ref.Line)
+	AssertEqual(t, 22, diagnostics[0].Ref.Col)
+	AssertEqual(t, `Admin has no inherited field "age" to exclude`, diagnostics[1].Msg)
+	AssertEqual(t, dsl.CodeInvalidField, diagnostics[2].Code)
+}
+
+func TestAbstractEntitiesCannotBeGenerated(t *testing.T) {
+	i := interp()
+	i.SetSortFields(true) // keeps the generated entities as they are
+	scope := NewRootScope()
+
+	err := i.LoadReader("mammals.lang", strings.NewReader(`abstract Mammal: { legs 4 }
+Dog: Mammal { name "rex" }
+generate (1, Dog)
+generate (1, Mammal { name "anon" })`), scope)
+	AssertNil(t, err, "Didn't expect to get an error: %v", err)
+
+	Assert(t, scope.ResolveSymbol("Mammal").Value.(*generator.Generator).Abstract(), "Expected Mammal to be abstract")
+	AssertEqual(t, int64(4), i.output["Dog"][0].(generator.EntityResult)["legs"])
+	AssertEqual(t, 1, len(i.output["Mammal"]), "Anonymous extensions of abstract entities should be generated")
+
+	err = interp().CheckReader("mammals.lang", strings.NewReader(`abstract Mammal: { legs 4 }
+generate (1, Mammal)`), NewRootScope())
+
+	diagnostics := Diagnostics(err)
+	AssertEqual(t, 1, len(diagnostics))
+	AssertEqual(t, `Entity "Mammal" is abstract, so only the entities that extend it may be generated`, diagnostics[0].Msg)
+	AssertEqual(t, dsl.CodeInvalidGenerate, diagnostics[0].Code)
+	AssertEqual(t, 2, diagnostics[0].Ref.Line)
+	AssertEqual(t, 14, diagnostics[0].Ref.Col)
+}
+
+func TestFieldsCannotNestAbstractEntities(t *testing.T) {
+	err := interp().CheckReader("zoo.lang", strings.NewReader(`abstract Animal: { legs 4 }
+Cat: Animal {}
+Zoo: {
+  mascot Animal,
+  many   Animal[2],
+  cats   Cat[2],
+  pet    Animal { name "rex" }
+}`), NewRootScope())
+
+	diagnostics := Diagnostics(err)
+	AssertEqual(t, 2, len(diagnostics), "Expected only the fields that nest Animal itself to be rejected, but got %v", diagnostics)
+	AssertEqual(t, `Field "mascot" nests "Animal", which is abstract, so only the entities that extend it may be nested`, diagnostics[0].Msg)
+	AssertEqual(t, dsl.CodeTypeMismatch, diagnostics[0].Code)
+	AssertEqual(t, 4, diagnostics[0].Ref.Line)
+	AssertEqual(t, 10, diagnostics[0].Ref.Col)
+	AssertEqual(t, `Field "many" nests "Animal", which is abstract, so only the entities that extend it may be nested`, diagnostics[1].Msg)
+	AssertEqual(t, 5, diagnostics[1].Ref.Line)
+}
+
+func TestUnionsMixEntitiesOfSeveralTypes(t *testing.T) {
+	i := interp()
+	i.SetSortFields(true) // keeps the generated entities as they are
+
+	err := i.LoadReader("payments.lang", strings.NewReader(`abstract Payment: { amount 10 }
+CreditCard: Payment { number "4111" }
+BankTransfer: Payment { iban "DE00" }
+let RARELY = 1
+
+Order: { payments CreditCard * 5 | BankTransfer * RARELY [20] }
+
+generate (1, Order)
+generate (30, CreditCard * 2 | BankTransfer)`), NewRootScope())
+	AssertNil(t, err, "Didn't expect to get an error: %v", err)
+
+	payments := i.output["Order"][0].(generator.EntityResult)["payments"].([]interface{})
+	AssertEqual(t, 20, len(payments))
+
+	for _, payment := range payments {
+		for entityType, entities := range payment.(map[string]generator.GeneratedEntities) {
+			AssertEqual(t, entityType, entities[0]["$type"])
+			AssertEqual(t, int64(10), entities[0]["amount"])
+		}
+	}
+
+	mixed := i.output["Payment"]
+	AssertEqual(t, 30, len(mixed), "Mixed entities should be written together, under the type they share")
+
+	types := make(map[interface{}]bool)
+	for _, entity := range mixed {
+		types[entity.(generator.EntityResult)["$type"]] = true
+	}
+	Assert(t, types["CreditCard"] && types["BankTransfer"], "Expected both types of payment, but got %v", types)
+}
+
+func TestUnionAlternativesAreChecked(t *testing.T) {
+	err := interp().CheckReader("payments.lang", strings.NewReader(`abstract Payment: {}
+CreditCard: Payment {}
+Order: { payment CreditCard * 0 | Payment }
+generate (1, CreditCard | Payment)
+generate (1, CreditCard * "often" | Nope)`), NewRootScope())
+
+	diagnostics := Diagnostics(err)
+	AssertEqual(t, 3, len(diagnostics))
+
+	AssertEqual(t, "The weight of a union's alternative must be a positive integer, but was 0", diagnostics[0].Msg)
+	AssertEqual(t, 3, diagnostics[0].Ref.Line)
+	AssertEqual(t, 31, diagnostics[0].Ref.Col)
+	AssertEqual(t, `Entity "Payment" is abstract, so it can't be one of a union's alternatives`, diagnostics[1].Msg)
+	AssertEqual(t, 4, diagnostics[1].Ref.Line)
+	AssertEqual(t, 27, diagnostics[1].Ref.Col)
+	AssertEqual(t, dsl.CodeInvalidArguments, diagnostics[2].Code)
+}
+
+func TestArrayAndObjectLiterals(t *testing.T) {
+	i := interp()
+	i.SetSortFields(true) // keeps the generated entities as they are
+
+	err := i.LoadReader("literals.lang", strings.NewReader(`let COLORS = ["red", "green"]
+
+Product(colors pick): {
+  tags   ["sale", [1, 2.5]],
+  config {"depth": 2, "nested": {"on": true}},
+  color  pick(colors),
+  many   pick(["a", "b"])[3],
+  shades COLORS
+}
+
+generate (1, Product(COLORS))`), NewRootScope())
+	AssertNil(t, err, "Didn't expect to get an error: %v", err)
+
+	product := i.output["Product"][0].(generator.EntityResult)
+	AssertEqual(t, "[sale [1 2.5]]", fmt.Sprintf("%v", product["tags"]))
+	AssertEqual(t, "map[depth:2 nested:map[on:true]]", fmt.Sprintf("%v", product["config"]))
+	Assert(t, product["color"] == "red" || product["color"] == "green", "Expected one of the colors, but got %v", product["color"])
+	AssertEqual(t, 3, len(product["many"].([]interface{})))
+	AssertEqual(t, "[red green]", fmt.Sprintf("%v", product["shades"]))
+
+	err = interp().CheckReader("literals.lang", strings.NewReader(`Thing: { a pick([]), b pick("red"), c pick }`), NewRootScope())
+	diagnostics := Diagnostics(err)
+	AssertEqual(t, 3, len(diagnostics))
+	AssertEqual(t, "Field type `pick` needs an array with at least one element to pick from", diagnostics[0].Msg)
+	AssertEqual(t, "Expected red to be an array, but was string.", diagnostics[1].Msg)
+	AssertEqual(t, "Field of type `pick` requires arguments", diagnostics[2].Msg)
+}
+
+func TestStructs(t *testing.T) {
+	i := interp()
+	i.SetSortFields(true)
+
+	err := i.LoadReader("structs.lang", strings.NewReader(`Person: {
+  address struct { street string(10), city "Chicago", hidden zip integer(10000, 99999) },
+  wallet  struct { amount integer(1, 9), currency "USD" }[2]
+}
+
+generate (1, Person)`), NewRootScope())
+	AssertNil(t, err, "Didn't expect to get an error: %v", err)
+
+	person := i.output["Person"][0].(generator.EntityResult)
+	AssertEqual(t, "[city street]", fmt.Sprintf("%v", keys(person["address"].(generator.EntityResult))))
+	AssertEqual(t, 2, len(person["wallet"].([]interface{})))
+	AssertEqual(t, "USD", person["wallet"].([]interface{})[1].(generator.EntityResult)["currency"])
+
+	err = interp().CheckReader("structs.lang", strings.NewReader(`Thing: { a struct { b 1 }(2), c struct { d unknown } }`), NewRootScope())
+	diagnostics := Diagnostics(err)
+	AssertEqual(t, 2, len(diagnostics))
+	AssertEqual(t, "A struct takes no arguments; give it a bound, e.g. [1, 3], for several of them", diagnostics[0].Msg)
+	AssertEqual(t, `Cannot resolve symbol "unknown"`, diagnostics[1].Msg)
+}
+
+func TestEveryFieldKindTakesTheSameBounds(t *testing.T) {
+	i := interp()
+	i.SetSortFields(true)
+	logger := GetLogger(t)
+	i.SetLogger(logger)
+
+	err := i.LoadReader("bounds.lang", strings.NewReader(`Cat: { name "Tom" }
+
+Person: {
+  none   string(3)[0, 0],
+  noCats Cat[0],
+  cats   Cat(2),
+  some   integer(1, 5)[1, 4, "normal"]
+}
+
+generate (1, Person)`), NewRootScope())
+	AssertNil(t, err, "Didn't expect to get an error: %v", err)
+
+	person := i.output["Person"][0].(generator.EntityResult)
+	AssertEqual(t, 0, len(person["none"].([]interface{})))
+	AssertEqual(t, 0, len(person["noCats"].([]interface{})))
+	AssertEqual(t, 2, len(person["cats"].([]interface{})), "Expected the deprecated argument to still nest 2 cats")
+	Assert(t, len(person["some"].([]interface{})) >= 1 && len(person["some"].([]interface{})) <= 4, "Expected 1 to 4 values, but got %v", person["some"])
+
+	AssertEqual(t, 1, len(logger.Warnings()))
+	Assert(t, strings.Contains(logger.Warnings()[0], `W307: Field "cats" nests 2 entities by argument, which is deprecated; use a bound instead, e.g. [2]`), "Expected a deprecation warning, but got %v", logger.Warnings())
+}
+
+func TestParametersReplaceLetValues(t *testing.T) {
+	spec := `let users = 10
+let region = "us"
+let ages = (18, 65)
+
+User: { region region, age integer(ages) }
+
+generate (users, User)`
+
+	i := interp()
+	i.SetSortFields(true)
+	AssertNil(t, i.SetParameter("users", "3"), "Should be able to set a count")
+	AssertNil(t, i.SetParameter("region", "eu"), "Should be able to set a bare word")
+	AssertNil(t, i.SetParameter("ages", "(1, 1)"), "Should be able to set a range")
+	AssertNil(t, i.SetParameter("unused", "true"), "Should be able to set a parameter the spec doesn't have")
+	ExpectsError(t, `Cannot set "9lives"; parameters are named like any identifier, e.g. users=100`, i.SetParameter("9lives", "1"))
+
+	err := i.LoadReader("parameters.lang", strings.NewReader(spec), NewRootScope())
+	AssertNil(t, err, "Didn't expect to get an error: %v", err)
+
+	users := i.output["User"]
+	AssertEqual(t, 3, len(users))
+	AssertEqual(t, "eu", users[0].(generator.EntityResult)["region"])
+	AssertEqual(t, 1, users[0].(generator.EntityResult)["age"])
+	AssertEqual(t, "[unused]", fmt.Sprintf("%v", i.UnassignedParameters()))
+}
+
+func TestScaleMultipliesGenerateCounts(t *testing.T) {
+	i := interp()
+	ExpectsError(t, "The scale must be greater than 0, but was -1", i.SetScale(-1))
+	AssertNil(t, i.SetScale(0.25), "Should be able to scale down")
+
+	err := i.LoadReader("scale.lang", strings.NewReader(`let users = 10
+generate (users, User: { name "x" })
+generate (1, Admin: { name "y" })`), NewRootScope())
+	AssertNil(t, err, "Didn't expect to get an error: %v", err)
+
+	AssertEqual(t, 3, len(i.output["User"]), "Expected 10 * 0.25 to round to 3")
+	AssertEqual(t, 1, len(i.output["Admin"]), "Expected a scaled count to never fall below 1")
+}
+
+func TestSelfNestingEntitiesWarnWhenDefined(t *testing.T) {
+	i := interp()
+	logger := GetLogger(t)
+	i.SetLogger(logger)
+	AssertNil(t, i.SetNestingLimit(generator.NestingLimit{MaxDepth: 2, Truncate: generator.TruncateWithNull}), "Expected a valid nesting limit")
+
+	err := i.CheckReader("nesting.lang", strings.NewReader(`Person: { friend Person }
+Pet: { friends Pet[0, 2] }
+Employee: Person {}
+Loop: { other Other: { back Loop } }
+generate (1, Person)
+generate (1, Pet)`), NewRootScope())
+
+	AssertNil(t, err, "Didn't expect to get an error: %v", err)
+	AssertEqual(t, 2, len(logger.Warnings()), "Expected each cycle to be reported once, but got %v", logger.Warnings())
+	Assert(t, strings.Contains(logger.Warnings()[0], `nesting.lang:1:1: warning W303: Entity "Person" nests itself without end (Person.friend -> Person), so it will be cut off after 2 levels`), "Unexpected warning: %v", logger.Warnings())
+	Assert(t, strings.Contains(logger.Warnings()[1], `nesting.lang:4:1: warning W303: Entity "Loop" nests itself without end (Loop.other -> Other.back -> Loop), so it will be cut off after 2 levels`), "Unexpected warning: %v", logger.Warnings())
+
+	ExpectsError(t, "Maximum nesting depth must be at least 1, but was 0", i.SetNestingLimit(generator.NestingLimit{MaxDepth: 0, Truncate: generator.TruncateWithNull}))
+}
+
+func TestEntityFromNodeReportsAllFieldErrors(t *testing.T) {
+	_, err := interp().EntityFromNode(EntityNode("person", dsl.NodeSet{
+		FieldNode("name", BuiltinNode("dict"), IntArgs(1)...),
+		FieldNode("age", BuiltinNode("integer"), IntArgs(10, 1)...),
+	}), NewRootScope())
+
+	ExpectsError(t, "Expected 1 to be a string, but was int64.\nmax 1 cannot be less than min 10", err)
+}
+
+func TestVisitReportsAllErrorsButStopsGeneratingAfterTheFirst(t *testing.T) {
+	i := interp()
+	node := RootNode(
+		EntityNode("person", validFields),
+		GenerationNode(IdNode("nobody"), 1),
+		GenerationNode(IdNode("person"), 1),
+		GenerationNode(IdNode("no_one"), 1),
+	)
+
+	ExpectsError(t, "Cannot resolve symbol \"nobody\"\nCannot resolve symbol \"no_one\"", i.Visit(node, NewRootScope()))
+	AssertEqual(t, 0, len(i.output), "Should not generate entities once an error has occurred")
+
+	scope := NewRootScope()
+	i.Visit(RootNode(EntityNode("person", validFields)), scope)
+	AssertNil(t, i.Visit(RootNode(GenerationNode(IdNode("person"), 1)), scope), "Didn't expect an error")
+	AssertEqual(t, 1, len(i.output["person"]), "Should generate again once the erroring load is done")
+}
+
+func TestDiagnosticsFlattensErrors(t *testing.T) {
+	node := IdNode("eek")
+	errors := ErrorList{node.CodedErr(dsl.CodeUnresolvedSymbol, "one"), fmt.Errorf("two")}
+	diagnostics := Diagnostics(errors)
+
+	AssertEqual(t, 2, len(diagnostics))
+	AssertEqual(t, dsl.CodeUnresolvedSymbol, diagnostics[0].Code)
+	AssertEqual(t, dsl.CodeUnknown, diagnostics[1].Code)
+	AssertEqual(t, 0, len(Diagnostics(nil)))
+}
+
+func TestLintReportsLikelyMistakes(t *testing.T) {
+	i := interp()
+	i.SetCustomDictonaryPath("testdata/lint")
+	defer i.SetCustomDictonaryPath("")
+
+	logger := GetLogger(t)
+	warnings, err := i.Lint("testdata/lint/issues.lang", logger)
+	AssertNil(t, err, "Didn't expect to get an error: %v", err)
+
+	imported, _ := filepath.Abs("testdata/lint/imported.lang")
+	expected := []string{
+		`W305 1 of 3 entries in custom dictionary "colors" are blank; those values will come from the builtin "colors" dictionary instead`,
+		fmt.Sprintf(`W301 Entity "Pet" replaces the one defined at %s:1`, imported),
+		`W304 Field "friends" may generate up to 1000000 values for each entity; did you mean a smaller bound?`,
+		`W302 Field "age" changes the type of Person.age from integer to string`,
+		`W305 1 of 3 entries in custom dictionary "colors" are blank; those values will come from the builtin "colors" dictionary instead`,
+		`W307 Field "pets" nests entities by argument, which is deprecated; use a bound instead, e.g. [2]`,
+		`W300 Abstract entity "Unused" is never extended`,
+		`W300 Entity "Orphan" is never generated or referenced`,
+		`W303 Entity "Loop" nests itself without end (Loop.other -> Other.back -> Loop), so its generated values will be cut off at the maximum nesting depth; give one of these fields a bound like [0, 1] or override it with null`,
+	}
+
+	AssertEqual(t, len(expected), len(warnings), "Expected %d warnings, but got %v", len(expected), warnings)
+	AssertEqual(t, len(expected), len(logger.Warnings()))
+
+	for idx, msg := range expected {
+		if idx < len(warnings) {
+			AssertEqual(t, msg, warnings[idx].Code+" "+warnings[idx].Msg)
+			AssertEqual(t, dsl.SeverityWarning, warnings[idx].Severity)
+		}
+	}
+}
+
+func TestLintCleanSpec(t *testing.T) {
+	warnings, err := interp().Lint("testdata/lint/clean.lang", GetLogger(t))
+	AssertNil(t, err, "Didn't expect to get an error: %v", err)
+	AssertEqual(t, 0, len(warnings), "Expected no warnings, but got %v", warnings)
+}
+
+func TestLintCountsReferencesFromTemplatesAndLets(t *testing.T) {
+	warnings, err := interp().Lint("testdata/lint/templates.lang", GetLogger(t))
+	AssertNil(t, err, "Didn't expect to get an error: %v", err)
+	AssertEqual(t, 0, len(warnings), "Expected no warnings, but got %v", warnings)
+}
+
+func TestLintReturnsLoadErrors(t *testing.T) {
+	_, err := interp().Lint("testdata/semantic_errors.lang", GetLogger(t))
+	Assert(t, nil != err, "Expected an error for an invalid spec")
+}
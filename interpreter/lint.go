@@ -0,0 +1,366 @@
+package interpreter
+
+import (
+	"github.com/ThoughtWorksStudios/bobcat/dictionary"
+	"github.com/ThoughtWorksStudios/bobcat/dsl"
+	"github.com/ThoughtWorksStudios/bobcat/generator"
+	"github.com/ThoughtWorksStudios/bobcat/logging"
+	fs "path/filepath"
+	"strings"
+)
+
+// multi-value bounds beyond this are more likely typos than intentions
+const hugeBound = 1000
+
+// the field types that a literal may override without changing the field's type
+var literalFits = map[string][]string{
+	"literal-int":    {"integer", "decimal"},
+	"literal-float":  {"decimal"},
+	"literal-string": {"string", "dict"},
+	"literal-date":   {"date"},
+}
+
+/**
+ * Lint looks for likely mistakes in an otherwise valid spec, reporting each one
+ * as a warning through the logger. Errors that prevent the spec from loading are
+ * returned just as CheckFile() would, in which case there are no warnings.
+ */
+func (i *Interpreter) Lint(filename string, logger logging.ILogger) ([]*dsl.Diagnostic, error) {
+	scope := NewRootScope()
+
+	original := i.logger
+	i.dryRun, i.logger = true, &logging.QuietLogger{} // the linter reports its own, more thorough, warnings instead
+	defer func() { i.dryRun, i.logger = false, original }()
+
+	if err := i.LoadFile(filename, scope); err != nil {
+		return nil, err
+	}
+
+	realpath, err := resolve(filename, i.basedir)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &linter{
+		scope:       scope,
+		dictionary:  i.dictionary,
+		warnings:    make([]*dsl.Diagnostic, 0),
+		seen:        make(map[string]bool),
+		definitions: make(map[string]dsl.Node),
+		order:       make([]string, 0),
+		used:        make(map[string]bool),
+		extended:    make(map[string]bool),
+	}
+
+	l.lintFile(realpath)
+	l.checkUnused()
+	l.checkNesting()
+
+	for _, w := range l.warnings {
+		logger.Warn("%s", dsl.Render(w))
+	}
+
+	return l.warnings, nil
+}
+
+type linter struct {
+	scope       *Scope
+	dictionary  *dictionary.Dictionary
+	warnings    []*dsl.Diagnostic
+	seen        map[string]bool
+	definitions map[string]dsl.Node // top-level entities by name, as last defined
+	order       []string            // top-level entity names, in the order they were first defined
+	used        map[string]bool     // entities that are generated or referenced by another entity
+	extended    map[string]bool     // entities that another entity extends
+}
+
+func (l *linter) warn(node dsl.Node, code, msg string, tokens ...interface{}) {
+	w := dsl.NewWarning(code, msg, tokens...)
+	w.Ref = node.Ref
+	l.warnings = append(l.warnings, w)
+}
+
+// walks statements in the same order as the interpreter, following imports as they appear
+func (l *linter) lintFile(filename string) {
+	l.seen[filename] = true
+
+	parsed, err := parseFile(filename)
+	if err != nil {
+		return // can't happen, as the spec has already been loaded
+	}
+
+	for _, statement := range parsed.(dsl.Node).Children {
+		switch statement.Kind {
+		case "import":
+			if path, e := resolve(statement.ValStr(), fs.Dir(filename)); e == nil && !l.seen[path] {
+				l.lintFile(path)
+			}
+		case "entity":
+			if statement.Name != "" {
+				if previous, defined := l.definitions[statement.Name]; defined {
+					l.warn(statement, dsl.CodeShadowedEntity, "Entity %q replaces the one defined at %s:%d", statement.Name, previous.Ref.Filename, previous.Ref.Line)
+				} else {
+					l.order = append(l.order, statement.Name)
+				}
+
+				l.definitions[statement.Name] = statement
+			}
+
+			l.lintEntity(statement, statement.Name)
+		case "template":
+			l.lintEntity(statement.ValNode(), statement.Name)
+		case "let":
+			if value := statement.ValNode(); value.Kind == "identifier" { // e.g. let Supplier = Vendor
+				l.use(value.ValStr(), "")
+			}
+		case "generation":
+			l.lintEntityRef(statement.ValNode(), "")
+		}
+	}
+}
+
+func (l *linter) lintEntityRef(node dsl.Node, owner string) {
+	switch node.Kind {
+	case "identifier":
+		l.use(node.ValStr(), owner)
+	case "union":
+		for _, alternative := range node.Children {
+			l.lintEntityRef(alternative.ValNode(), owner)
+		}
+	default:
+		l.lintEntity(node, owner)
+	}
+}
+
+// references from within an entity's own definition don't count as uses of it
+func (l *linter) use(name, owner string) {
+	if name != owner {
+		l.used[name] = true
+	}
+}
+
+func (l *linter) lintEntity(node dsl.Node, owner string) {
+	for _, parent := range node.Parents() {
+		l.use(parent.ValStr(), owner)
+
+		if parent.ValStr() != owner {
+			l.extended[parent.ValStr()] = true
+		}
+	}
+
+	if node.HasRelation() {
+		l.checkOverrides(node)
+	}
+
+	for _, field := range node.Children {
+		if field.Kind == "exclusion" {
+			continue
+		}
+
+		value := field.ValNode()
+
+		switch value.Kind {
+		case "identifier":
+			l.use(value.ValStr(), owner)
+		case "entity":
+			if previous, shadows := l.definitions[value.Name]; value.Name != "" && shadows {
+				l.warn(value, dsl.CodeShadowedEntity, "Entity %q shadows the one defined at %s:%d", value.Name, previous.Ref.Filename, previous.Ref.Line)
+			}
+
+			l.lintEntity(value, owner)
+		case "union":
+			l.lintEntityRef(value, owner)
+		case "struct":
+			l.lintEntity(value, owner)
+		case "builtin":
+			if value.ValStr() == "dict" && len(field.Args) == 1 && field.Args[0].Kind == "literal-string" {
+				for _, msg := range l.dictionary.Fallbacks(field.Args[0].ValStr()) {
+					l.warn(field.Args[0], dsl.CodeDictionaryFallback, "%s", msg)
+				}
+			}
+		}
+
+		if l.countsByArgument(field) {
+			l.warn(field.Args[0], dsl.CodeDeprecated, "Field %q nests entities by argument, which is deprecated; use a bound instead, e.g. [%s]", field.Name, field.Args[0].Raw)
+		}
+
+		if len(field.Bound) > 0 {
+			max := field.Bound[0] // a count, or else a min and max, and perhaps a distribution
+			if len(field.Bound) > 1 {
+				max = field.Bound[1]
+			}
+
+			if max.Kind == "literal-int" && max.ValInt() > hugeBound {
+				l.warn(max, dsl.CodeHugeBound, "Field %q may generate up to %d values for each entity; did you mean a smaller bound?", field.Name, max.ValInt())
+			}
+		}
+	}
+}
+
+// e.g. pets Cat(3), though templates are instantiated with arguments
+func (l *linter) countsByArgument(field dsl.Node) bool {
+	if len(field.Args) == 0 {
+		return false
+	}
+
+	switch value := field.ValNode(); value.Kind {
+	case "identifier":
+		entry := l.scope.ResolveSymbol(value.ValStr())
+		return nil == entry || entry.Type == "entity"
+	case "entity", "union":
+		return true
+	}
+	return false
+}
+
+// warns when an extension changes the type of an inherited field
+func (l *linter) checkOverrides(node dsl.Node) {
+	inherited := make(map[string]generator.FieldInfo)
+
+	for _, ref := range node.Parents() {
+		entry := l.scope.ResolveSymbol(ref.ValStr())
+		if nil == entry {
+			continue
+		}
+
+		if parent, ok := entry.Value.(*generator.Generator); ok {
+			for _, info := range parent.Describe() {
+				inherited[info.Name] = info // later parents win, as they do when generating
+			}
+		}
+	}
+
+	for _, field := range node.Children {
+		original, overrides := inherited[field.Name]
+
+		if !overrides || field.Kind == "exclusion" || original.Type == "literal" || l.compatible(field.ValNode(), original.Type) {
+			continue
+		}
+
+		l.warn(field, dsl.CodeOverriddenType, "Field %q changes the type of %s.%s from %s to %s", field.Name, original.Origin, field.Name, original.Type, describeType(field.ValNode()))
+	}
+}
+
+func (l *linter) compatible(value dsl.Node, expected string) bool {
+	switch {
+	case value.Kind == "literal-null":
+		return true // nulling out an inherited field is deliberate
+	case strings.HasPrefix(value.Kind, "literal-"):
+		for _, fits := range literalFits[value.Kind] {
+			if fits == expected {
+				return true
+			}
+		}
+		return false
+	case value.Kind == "builtin":
+		return value.ValStr() == expected
+	case value.Kind == "struct":
+		return expected == "struct"
+	case value.Kind == "identifier":
+		return l.isA(value.ValStr(), expected)
+	case value.Kind == "union":
+		for _, alternative := range value.Children {
+			if !l.compatible(alternative.ValNode(), expected) {
+				return false
+			}
+		}
+		return true
+	case value.Kind == "entity":
+		if value.Name == expected {
+			return true
+		}
+
+		for _, parent := range value.Parents() {
+			if l.isA(parent.ValStr(), expected) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// whether an entity is, or extends (through any of its parents), the expected one
+func (l *linter) isA(name, expected string) bool {
+	visited := make(map[string]bool)
+
+	var extends func(name string) bool
+	extends = func(name string) bool {
+		if name == expected {
+			return true
+		}
+
+		if visited[name] {
+			return false
+		}
+		visited[name] = true
+
+		for _, parent := range l.definitions[name].Parents() {
+			if extends(parent.ValStr()) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return extends(name)
+}
+
+func describeType(value dsl.Node) string {
+	switch value.Kind {
+	case "builtin", "identifier":
+		return value.ValStr()
+	case "struct":
+		return "struct"
+	case "union":
+		types := make([]string, len(value.Children))
+		for idx, alternative := range value.Children {
+			types[idx] = describeType(alternative.ValNode())
+		}
+		return strings.Join(types, " | ")
+	case "entity":
+		if value.Name != "" {
+			return value.Name
+		}
+		if value.HasRelation() {
+			return value.Related.ValStr()
+		}
+		return "entity"
+	default:
+		return strings.TrimPrefix(value.Kind, "literal-") + " literal"
+	}
+}
+
+// abstract entities are only of use when extended
+func (l *linter) checkUnused() {
+	for _, name := range l.order {
+		if l.definitions[name].Abstract {
+			if !l.extended[name] {
+				l.warn(l.definitions[name], dsl.CodeUnusedEntity, "Abstract entity %q is never extended", name)
+			}
+		} else if !l.used[name] {
+			l.warn(l.definitions[name], dsl.CodeUnusedEntity, "Entity %q is never generated or referenced", name)
+		}
+	}
+}
+
+// entities that nest themselves without end are cut off at the maximum depth when generated
+func (l *linter) checkNesting() {
+	roots := make([]*generator.Generator, 0, len(l.order))
+
+	for _, name := range l.order {
+		if entry := l.scope.ResolveSymbol(name); nil != entry {
+			if g, ok := entry.Value.(*generator.Generator); ok && !g.Abstract() {
+				roots = append(roots, g) // cycles of abstract entities are reported where they are extended
+			}
+		}
+	}
+
+	for _, cycle := range generator.Cycles(roots...) {
+		at, ok := l.definitions[cycle.Entity.Type()]
+		if !ok {
+			at = l.definitions[cycle.Root.Type()]
+		}
+
+		l.warn(at, dsl.CodeEndlessNesting, "Entity %q nests itself without end (%s), so its generated values will be cut off at the maximum nesting depth; give one of these fields a bound like [0, 1] or override it with null", cycle.Entity.Type(), strings.Join(cycle.Path, " -> "))
+	}
+}
@@ -4,24 +4,21 @@ import (
 	"bufio"
 	"encoding/json"
 	"fmt"
-	g "github.com/ThoughtWorksStudios/bobcat/generator"
 	"io"
 	"os"
+	"strings"
 )
 
-type GenerationOutput map[string]g.GeneratedEntities
+// generated entities by type: g.EntityResults, or json.Marshalers that write their fields in order
+type GenerationOutput map[string][]interface{}
 
-func (output GenerationOutput) addAndAppend(entityName string, entities g.GeneratedEntities) {
-	if _, ok := output[entityName]; ok {
-		output[entityName] = output[entityName].Concat(entities)
-	} else {
-		output[entityName] = entities
-	}
+func (output GenerationOutput) addAndAppend(entityName string, entities []interface{}) {
+	output[entityName] = append(output[entityName], entities...)
 }
 
 func (output GenerationOutput) writeFilePerKey() error {
 	for k, v := range output {
-		out, err := createWriterFor(fmt.Sprintf("%s.json", k))
+		out, err := createWriterFor(splitFilename(k))
 		if err != nil {
 			return err
 		}
@@ -48,6 +45,10 @@ func (output GenerationOutput) write(out io.Writer) error {
 		defer closeable.Close()
 	}
 
+	return output.encode(out)
+}
+
+func (output GenerationOutput) encode(out io.Writer) error {
 	writer := bufio.NewWriter(out)
 	encoder := json.NewEncoder(writer)
 	encoder.SetIndent("", "\t")
@@ -64,6 +65,11 @@ func isClosable(v interface{}) (io.Closer, bool) {
 	return closeable, doClose
 }
 
+// unions of unrelated entities are collected as e.g. "Cat|Dog", which is written to Cat-Dog.json
+func splitFilename(collection string) string {
+	return fmt.Sprintf("%s.json", strings.Replace(collection, "|", "-", -1))
+}
+
 func createWriterFor(filename string) (io.Writer, error) {
 	var f interface{}
 	var err error
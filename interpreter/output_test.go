@@ -1,16 +1,21 @@
 package interpreter
 
 import (
+	"bytes"
 	g "github.com/ThoughtWorksStudios/bobcat/generator"
 	. "github.com/ThoughtWorksStudios/bobcat/test_helpers"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 )
 
 func TestAppendingToGenerationOutput(t *testing.T) {
 	actual := GenerationOutput{}
 
-	beast := g.GeneratedEntities{g.EntityResult{"of the beast": 666}}
+	beast := []interface{}{g.EntityResult{"of the beast": 666}}
 
 	expected := GenerationOutput{"sign": beast}
 	actual.addAndAppend("sign", beast)
@@ -25,6 +30,77 @@ func TestAppendingToGenerationOutput(t *testing.T) {
 		"sign": append(beast, rick),
 	}
 
-	actual.addAndAppend("sign", g.GeneratedEntities{rick})
+	actual.addAndAppend("sign", []interface{}{rick})
 	Assert(t, reflect.DeepEqual(expected, actual), "expected \n%v\n to be equal to \n%v\n but wasn't", expected, actual)
 }
+
+func TestSplitOutputFilenames(t *testing.T) {
+	AssertEqual(t, "Person.json", splitFilename("Person"))
+	AssertEqual(t, "Cat-Dog-Bird.json", splitFilename("Cat|Dog|Bird"))
+}
+
+func TestStreamedOutputMatchesCollectedOutput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bobcat-stream")
+	AssertNil(t, err, "Didn't expect an error: %v", err)
+	defer os.RemoveAll(dir)
+
+	spec := `Pet: { name dict("first_names") }
+Person: { name "Rick", pets Pet[1, 2], born date }
+generate (1500, Person)
+generate (2, Pet)
+generate (3, Person)`
+
+	collected := interp()
+	collected.SetSeed(7)
+	AssertNil(t, collected.LoadReader("stream.lang", strings.NewReader(spec), NewRootScope()), "Didn't expect an error")
+
+	var expected bytes.Buffer
+	AssertNil(t, collected.FlushGeneratedContent(&expected), "Didn't expect an error")
+
+	stream := NewOutputStream(filepath.Join(dir, "entities.json"), false)
+	streamed := interp()
+	streamed.now = collected.now
+	streamed.SetSeed(7)
+	AssertNil(t, streamed.SetWorkers(3), "Didn't expect an error")
+	streamed.StreamTo(stream)
+	AssertNil(t, streamed.LoadReader("stream.lang", strings.NewReader(spec), NewRootScope()), "Didn't expect an error")
+	AssertNil(t, stream.Close(), "Didn't expect an error")
+
+	actual, err := ioutil.ReadFile(filepath.Join(dir, "entities.json"))
+	AssertNil(t, err, "Didn't expect an error: %v", err)
+	Assert(t, expected.String() == string(actual), "Expected streamed output to match collected output")
+
+	ExpectsError(t, "The number of workers must be at least 1, but was 0", streamed.SetWorkers(0))
+}
+
+func TestOutputWritesFieldsInDeclarationOrder(t *testing.T) {
+	spec := `Pet: { species "cat", name "Tom" }
+Person: { zodiac "leo", age 42, pet Pet }
+Employee: Person { badge 7, company "Vandelay" }
+generate (1, Employee)`
+
+	keys := func(sorted bool) []string {
+		i := interp()
+		i.SetSortFields(sorted)
+		AssertNil(t, i.LoadReader("order.lang", strings.NewReader(spec), NewRootScope()), "Didn't expect an error")
+
+		var out bytes.Buffer
+		AssertNil(t, i.FlushGeneratedContent(&out), "Didn't expect an error")
+
+		var result []string
+		for _, line := range strings.Split(out.String(), "\n") {
+			if fields := strings.Fields(line); len(fields) > 0 && strings.HasSuffix(fields[0], `":`) {
+				result = append(result, strings.Trim(fields[0], `":`))
+			}
+		}
+		return result
+	}
+
+	expected := []string{"Employee", "$id", "$type", "$species", "$extends", "zodiac", "age", "pet",
+		"Pet", "$id", "$type", "$species", "$parent", "species", "name", "badge", "company"}
+	AssertEqual(t, strings.Join(expected, " "), strings.Join(keys(false), " "))
+
+	expected = []string{"Employee", "$extends", "$id", "$species", "$type", "age", "badge", "company", "pet",
+		"Pet", "$id", "$parent", "$species", "$type", "name", "species", "zodiac"}
+	AssertEqual(t, strings.Join(expected, " "), strings.Join(keys(true), " "))
+}
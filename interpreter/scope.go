@@ -1,5 +1,7 @@
 package interpreter
 
+import "sort"
+
 type ScopeEntry struct {
 	Type  string
 	Value interface{}
@@ -29,6 +31,33 @@ func (s *Scope) SetSymbol(identifier, valueType string, value interface{}) {
 	s.symbols[identifier] = &ScopeEntry{Type: valueType, Value: value}
 }
 
+// the symbols defined directly in this scope, i.e. not those of its parents, in alphabetical order
+func (s *Scope) Names() []string {
+	names := make([]string, 0, len(s.symbols))
+	for name := range s.symbols {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// a copy of the symbols defined directly in this scope, which Restore() can later put back
+func (s *Scope) Symbols() SymbolTable {
+	symbols := make(SymbolTable, len(s.symbols))
+	for name, entry := range s.symbols {
+		symbols[name] = entry
+	}
+	return symbols
+}
+
+// replaces the symbols defined directly in this scope with those from an earlier call to Symbols()
+func (s *Scope) Restore(symbols SymbolTable) {
+	s.symbols = make(SymbolTable, len(symbols))
+	for name, entry := range symbols {
+		s.symbols[name] = entry
+	}
+}
+
 func (s *Scope) Extend() *Scope {
 	return ExtendScope(s)
 }
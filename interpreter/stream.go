@@ -0,0 +1,149 @@
+package interpreter
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+)
+
+/**
+ * Writes generated entities out as they are generated, rather than collecting
+ * them in memory, producing the same files that WriteGeneratedContent() would.
+ * Entities are spooled to a temporary file per entity type, since the output
+ * groups them by type, and the destination file(s) are only written by Close().
+ */
+type OutputStream struct {
+	dest          string
+	filePerEntity bool
+	spools        map[string]*spool
+}
+
+// a temporary file holding the encoded entities of one type, separated by commas
+type spool struct {
+	file   *os.File
+	writer *bufio.Writer
+	empty  bool
+}
+
+func NewOutputStream(dest string, filePerEntity bool) *OutputStream {
+	return &OutputStream{dest: dest, filePerEntity: filePerEntity, spools: make(map[string]*spool)}
+}
+
+func (s *OutputStream) add(entityType string, entities []interface{}) error {
+	sp, ok := s.spools[entityType]
+
+	if !ok {
+		file, err := ioutil.TempFile("", "bobcat-")
+		if err != nil {
+			return err
+		}
+
+		sp = &spool{file: file, writer: bufio.NewWriter(file), empty: true}
+		s.spools[entityType] = sp
+	}
+
+	for _, entity := range entities {
+		// indented as if it were inside {"type": [...]}, just like GenerationOutput.encode()
+		encoded, err := json.MarshalIndent(entity, "\t\t", "\t")
+		if err != nil {
+			return err
+		}
+
+		if !sp.empty {
+			sp.writer.WriteString(",\n")
+		}
+
+		sp.writer.WriteString("\t\t")
+		if _, err = sp.writer.Write(encoded); err != nil {
+			return err
+		}
+
+		sp.empty = false
+	}
+
+	return nil
+}
+
+// writes the destination file(s), then removes the spooled entities
+func (s *OutputStream) Close() error {
+	defer s.Discard()
+
+	types := make([]string, 0, len(s.spools))
+	for entityType, sp := range s.spools {
+		if err := sp.writer.Flush(); err != nil {
+			return err
+		}
+		types = append(types, entityType)
+	}
+
+	sort.Strings(types)
+
+	if s.filePerEntity {
+		for _, entityType := range types {
+			if err := s.writeFile(splitFilename(entityType), entityType); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return s.writeFile(s.dest, types...)
+}
+
+// removes the spooled entities without writing anything, e.g. when a spec has errors
+func (s *OutputStream) Discard() {
+	for entityType, sp := range s.spools {
+		sp.file.Close()
+		os.Remove(sp.file.Name())
+		delete(s.spools, entityType)
+	}
+}
+
+func (s *OutputStream) writeFile(filename string, types ...string) error {
+	out, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	writer := bufio.NewWriter(out)
+
+	if len(types) == 0 {
+		writer.WriteString("{}\n")
+		return writer.Flush()
+	}
+
+	writer.WriteString("{\n")
+
+	for idx, entityType := range types {
+		key, _ := json.Marshal(entityType)
+		fmt.Fprintf(writer, "\t%s: [\n", key)
+
+		sp := s.spools[entityType]
+		if _, err := sp.file.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+
+		if _, err := io.Copy(writer, sp.file); err != nil {
+			return err
+		}
+
+		if idx < len(types)-1 {
+			writer.WriteString("\n\t],\n")
+		} else {
+			writer.WriteString("\n\t]\n")
+		}
+	}
+
+	writer.WriteString("}\n")
+
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+
+	return out.Close()
+}
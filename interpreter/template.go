@@ -0,0 +1,117 @@
+package interpreter
+
+import (
+	"github.com/ThoughtWorksStudios/bobcat/dsl"
+	"github.com/ThoughtWorksStudios/bobcat/generator"
+)
+
+// the validators for typed template parameters, e.g. `minPrice decimal`
+var paramValidators = map[string]Validator{
+	"integer": assertValInt,
+	"decimal": assertValFloat,
+	"string":  assertValStr,
+	"dict":    assertValStr,
+	"date":    assertValTime,
+	"pick":    assertValArray,
+}
+
+/**
+ * An entity definition with parameters, e.g. `Product(minPrice, maxPrice): { ... }`.
+ * Each instantiation, e.g. Product(1.0, 5.0), defines a new entity of the same type,
+ * with the parameters bound to the arguments as if by `let`.
+ */
+type Template struct {
+	node  dsl.Node
+	scope *Scope // the scope the template was defined in, which its body resolves symbols from
+}
+
+func (t *Template) Name() string {
+	return t.node.Name
+}
+
+func (t *Template) Params() dsl.NodeSet {
+	return t.node.Args
+}
+
+func (t *Template) String() string {
+	return t.node.Name + "(...)"
+}
+
+func (i *Interpreter) TemplateFromNode(node dsl.Node, scope *Scope) error {
+	seen := make(map[string]bool)
+
+	for _, param := range node.Args {
+		if seen[param.Name] {
+			return param.CodedErr(dsl.CodeInvalidArguments, "Template %q has more than one parameter named %q", node.Name, param.Name)
+		}
+		seen[param.Name] = true
+	}
+
+	scope.SetSymbol(node.Name, "template", &Template{node: node, scope: scope})
+	return nil
+}
+
+// resolves the arguments in the caller's scope, then defines the entity in a scope of its own
+func (i *Interpreter) instantiate(ref dsl.Node, template *Template, args dsl.NodeSet, scope *Scope) (*generator.Generator, error) {
+	args, err := i.resolveArgs(args, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = i.expectsParams(ref, template, args); err != nil {
+		return nil, err
+	}
+
+	instanceScope := ExtendScope(template.scope)
+	for idx, param := range template.Params() {
+		instanceScope.SetSymbol(param.Name, "literal", args[idx])
+	}
+
+	definition := template.node.ValNode()
+	definition.Name, definition.Ref = template.Name(), template.node.Ref
+
+	return i.EntityFromNode(definition, instanceScope)
+}
+
+// like expectsArgs(), but each parameter may have a type of its own, or none at all
+func (i *Interpreter) expectsParams(ref dsl.Node, template *Template, args dsl.NodeSet) error {
+	params := template.Params()
+
+	if l := len(args); len(params) != l {
+		return ref.CodedErr(dsl.CodeInvalidArguments, "Template `%s` expected %d args, but %d found.", template.Name(), len(params), l)
+	}
+
+	for idx, param := range params {
+		typeNode, typed := param.Value.(dsl.Node)
+		if !typed {
+			continue
+		}
+
+		paramType := typeNode.ValStr()
+
+		if err := paramValidators[paramType](args[idx]); err != nil {
+			return err
+		}
+
+		if paramType == "dict" {
+			if err := i.validateDictionary(args[idx]); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// resolves an identifier that refers to an entity, or instantiates the template it refers to with args
+func (i *Interpreter) resolveEntityRef(ref dsl.Node, args dsl.NodeSet, scope *Scope) (*generator.Generator, error) {
+	if entry := scope.ResolveSymbol(ref.ValStr()); nil != entry && entry.Type == "template" {
+		return i.instantiate(ref, entry.Value.(*Template), args, scope)
+	}
+
+	if nil != args {
+		return nil, ref.CodedErr(dsl.CodeInvalidArguments, "%q is not a template, so it takes no arguments", ref.ValStr())
+	}
+
+	return i.ResolveEntity(ref, scope)
+}
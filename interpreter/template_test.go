@@ -0,0 +1,75 @@
+package interpreter
+
+import (
+	"github.com/ThoughtWorksStudios/bobcat/dsl"
+	"github.com/ThoughtWorksStudios/bobcat/generator"
+	. "github.com/ThoughtWorksStudios/bobcat/test_helpers"
+	"strings"
+	"testing"
+)
+
+func assertBetween(t *testing.T, min, max float64, actual interface{}) {
+	value := actual.(float64)
+	Assert(t, min <= value && value <= max, "Expected %v to be between %v and %v", value, min, max)
+}
+
+func TestTemplatesAreInstantiatedWhereverEntitiesAreReferenced(t *testing.T) {
+	i := interp()
+	i.SetSortFields(true) // keeps the generated entities as they are
+	scope := NewRootScope()
+
+	err := i.LoadReader("template.lang", strings.NewReader(`let CHEAP = (1.0, 3.0)
+
+Product(minPrice decimal, maxPrice decimal, tier): {
+  price decimal(minPrice, maxPrice),
+  tier  tier
+}
+
+Cart: { items Product(CHEAP, "budget")[2] }
+Gift: Product(5.0, 7.0, "gift") { wrapped true }
+
+generate (1, Cart)
+generate (1, Gift)
+generate (2, Product(90.0, 99.0, "luxury"))`), scope)
+	AssertNil(t, err, "Didn't expect an error: %v", err)
+
+	AssertEqual(t, "template", scope.ResolveSymbol("Product").Type)
+	Assert(t, nil == scope.ResolveSymbol("minPrice"), "Parameters should not leak into the template's scope")
+
+	products := i.output["Product"]
+	AssertEqual(t, 2, len(products))
+	assertBetween(t, 90.0, 99.0, products[0].(generator.EntityResult)["price"])
+	AssertEqual(t, "luxury", products[1].(generator.EntityResult)["tier"])
+
+	gift := i.output["Gift"][0].(generator.EntityResult)
+	assertBetween(t, 5.0, 7.0, gift["price"])
+	AssertEqual(t, "Product", gift["$extends"])
+
+	items := i.output["Cart"][0].(generator.EntityResult)["items"].([]interface{})
+	AssertEqual(t, 2, len(items))
+
+	item := items[0].(map[string]generator.GeneratedEntities)["Product"][0]
+	assertBetween(t, 1.0, 3.0, item["price"])
+	AssertEqual(t, "budget", item["tier"])
+}
+
+func TestTemplateArgumentsAreChecked(t *testing.T) {
+	err := interp().CheckReader("template.lang", strings.NewReader(`Product(minPrice decimal, category dict): { price decimal(minPrice, 9.0) }
+Person: {}
+Cart: { one Product(1.0), two Product(1, "words"), three Product }
+generate (1, Product(1.0, "nope"))
+generate (1, Person(2))
+Twins(a, a): {}`), NewRootScope())
+
+	diagnostics := Diagnostics(err)
+	AssertEqual(t, 6, len(diagnostics))
+
+	AssertEqual(t, "Template `Product` expected 2 args, but 1 found.", diagnostics[0].Msg)
+	AssertEqual(t, 3, diagnostics[0].Ref.Line)
+	AssertEqual(t, 13, diagnostics[0].Ref.Col)
+	AssertEqual(t, "Expected 1 to be a decimal, but was int64.", diagnostics[1].Msg)
+	AssertEqual(t, "Template `Product` expected 2 args, but 0 found.", diagnostics[2].Msg)
+	AssertEqual(t, dsl.CodeUnknownDictionary, diagnostics[3].Code)
+	AssertEqual(t, `"Person" is not a template, so it takes no arguments`, diagnostics[4].Msg)
+	AssertEqual(t, `Template "Twins" has more than one parameter named "a"`, diagnostics[5].Msg)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"flag"
+	"github.com/ThoughtWorksStudios/bobcat/interpreter"
+	"github.com/ThoughtWorksStudios/bobcat/logging"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+func runLintCommand(args []string) {
+	flags := flag.NewFlagSet("lint", flag.ExitOnError)
+	flags.Usage = func() {
+		log.Print("Usage: ./bobcat lint [ options ] spec_file.lang")
+		log.Print("\nWarns about likely mistakes in a spec; exits with status 1 if there are any.\n\nOptions:")
+		flags.PrintDefaults()
+	}
+	customDicts := flags.String("d", "", "location of custom dictionary files; defaults to the directory of the spec")
+	diagnostics := flags.String("diagnostics", "text", "Format of reported problems: `text` for humans, or `json` for tools")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 || (*diagnostics != "text" && *diagnostics != "json") {
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	filename := flags.Arg(0)
+	i := interpreter.New()
+
+	if *customDicts == "" {
+		a, _ := filepath.Abs(filename)
+		i.SetCustomDictonaryPath(filepath.Dir(a))
+	} else {
+		i.SetCustomDictonaryPath(*customDicts)
+	}
+
+	var logger logging.ILogger = &logging.DefaultLogger{}
+	if *diagnostics == "json" {
+		logger = &logging.QuietLogger{} // warnings are reported as JSON diagnostics instead
+	}
+
+	warnings, errors := i.Lint(filename, logger)
+
+	if *diagnostics == "json" {
+		if errors != nil {
+			printDiagnostics(interpreter.Diagnostics(errors))
+		} else {
+			printDiagnostics(warnings)
+		}
+	} else if errors != nil {
+		log.Printf("Lint failed:\n\n%s\n", interpreter.RenderErrors(errors))
+	} else if len(warnings) == 0 {
+		log.Println("No problems found")
+	}
+
+	if errors != nil || len(warnings) > 0 {
+		os.Exit(1)
+	}
+}
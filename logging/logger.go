@@ -25,3 +25,10 @@ func (l *DefaultLogger) Die(err error) {
 func (l *DefaultLogger) Warn(msg string, tokens ...interface{}) {
 	log.Println("[WARN] " /* trailing space is intentional; matches same width as [ERROR] */, fmt.Sprintf(msg, tokens...))
 }
+
+// discards warnings, e.g. when they are reported some other way, but still dies on errors
+type QuietLogger struct {
+	DefaultLogger
+}
+
+func (l *QuietLogger) Warn(msg string, tokens ...interface{}) {}
@@ -0,0 +1,342 @@
+package lsp
+
+import (
+	"fmt"
+	"github.com/ThoughtWorksStudios/bobcat/dictionary"
+	"github.com/ThoughtWorksStudios/bobcat/dsl"
+	"github.com/ThoughtWorksStudios/bobcat/generator"
+	"github.com/ThoughtWorksStudios/bobcat/interpreter"
+	"github.com/ThoughtWorksStudios/bobcat/logging"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// keep in sync with `FieldTypes` in dsl.peg
+var builtinTypes = []string{"integer", "decimal", "string", "date", "dict", "pick"}
+
+// the cursor is inside the string argument of a dict() field, e.g. `name dict("full_`
+var dictArgPattern = regexp.MustCompile(`dict\(\s*"[^"]*$`)
+
+// an identifier or import path that appears in the analyzed document
+type reference struct {
+	ref      *dsl.Location
+	length   int
+	name     string // the entity name, or the resolved path of an import
+	isImport bool
+}
+
+/**
+ * Everything the server knows about an open document: its diagnostics (which
+ * may belong to imported files as well), the scope produced by checking it,
+ * and an index of the symbols it declares or refers to.
+ */
+type analysis struct {
+	path        string
+	text        string
+	diagnostics map[string][]Diagnostic // keyed by URI
+	scope       *interpreter.Scope
+	definitions map[string]*dsl.Location
+	references  []reference
+}
+
+func analyze(path, text string) *analysis {
+	a := &analysis{
+		path:        path,
+		text:        text,
+		diagnostics: map[string][]Diagnostic{pathToURI(path): []Diagnostic{}},
+		scope:       interpreter.NewRootScope(),
+		definitions: make(map[string]*dsl.Location),
+		references:  make([]reference, 0),
+	}
+
+	warnings := &warningCollector{warnings: make([]*dsl.Diagnostic, 0)}
+
+	i := interpreter.New()
+	i.SetLogger(warnings)
+	i.SetCustomDictonaryPath(filepath.Dir(path))
+
+	diagnostics := interpreter.Diagnostics(i.CheckReader(path, strings.NewReader(text), a.scope))
+
+	for _, d := range append(diagnostics, warnings.warnings...) {
+		uri := pathToURI(path)
+
+		if nil != d.Ref && d.Ref.Filename != "" {
+			uri = pathToURI(d.Ref.Filename)
+		}
+
+		a.diagnostics[uri] = append(a.diagnostics[uri], toDiagnostic(d))
+	}
+
+	// the interpreter doesn't expose its AST, so parse again to build the index; a
+	// partial AST is still returned when there are syntax errors
+	if ast, _ := dsl.ParseReader(path, strings.NewReader(text), dsl.GlobalStore("filename", path)); ast != nil {
+		if root, ok := ast.(dsl.Node); ok {
+			a.index(root, path, true, map[string]bool{path: true})
+		}
+	}
+
+	return a
+}
+
+/**
+ * Records entity declarations from the document and everything it imports, but
+ * only records references from the document itself since those are the only ones
+ * the client will ask about.
+ */
+func (a *analysis) index(node dsl.Node, filename string, local bool, seen map[string]bool) {
+	switch node.Kind {
+	case "root", "union", "struct":
+		for _, statement := range node.Children {
+			a.index(statement, filename, local, seen)
+		}
+	case "import":
+		target := node.ValStr()
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(filename), target)
+		}
+
+		if local && nil != node.Ref {
+			a.references = append(a.references, reference{ref: node.Ref, length: utf8.RuneCountInString(node.ValStr()) + 2, name: target, isImport: true})
+		}
+
+		if !seen[target] {
+			seen[target] = true
+			a.indexFile(target, seen)
+		}
+	case "entity", "template":
+		if node.Name != "" && nil != node.Ref {
+			a.definitions[node.Name] = node.Ref
+
+			if local {
+				a.references = append(a.references, reference{ref: node.Ref, length: utf8.RuneCountInString(node.Name), name: node.Name})
+			}
+		}
+
+		if node.Kind == "template" {
+			a.index(node.ValNode(), filename, local, seen)
+		}
+
+		for _, parent := range node.Parents() {
+			a.index(parent, filename, local, seen)
+		}
+
+		for _, field := range node.Children {
+			a.index(field, filename, local, seen)
+		}
+	case "let":
+		if nil != node.Ref {
+			a.definitions[node.Name] = node.Ref
+
+			if local {
+				a.references = append(a.references, reference{ref: node.Ref, length: utf8.RuneCountInString(node.Name), name: node.Name})
+			}
+		}
+
+		a.index(node.ValNode(), filename, local, seen)
+	case "generation", "field", "range", "builtin", "alternative":
+		if value, ok := node.Value.(dsl.Node); ok {
+			a.index(value, filename, local, seen)
+		}
+
+		for _, args := range []dsl.NodeSet{node.Args, node.Bound} {
+			for _, arg := range args {
+				a.index(arg, filename, local, seen)
+			}
+		}
+	case "identifier":
+		if local && nil != node.Ref {
+			a.references = append(a.references, reference{ref: node.Ref, length: utf8.RuneCountInString(node.ValStr()), name: node.ValStr()})
+		}
+
+		for _, arg := range node.Args { // a template's arguments
+			a.index(arg, filename, local, seen)
+		}
+	}
+}
+
+// imports that don't parse are skipped; the diagnostics already report why
+func (a *analysis) indexFile(filename string, seen map[string]bool) {
+	source, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return
+	}
+
+	if ast, _ := dsl.Parse(filename, source, dsl.GlobalStore("filename", filename)); ast != nil {
+		if root, ok := ast.(dsl.Node); ok {
+			a.index(root, filename, false, seen)
+		}
+	}
+}
+
+func (a *analysis) referenceAt(pos Position) *reference {
+	for idx, r := range a.references {
+		start := r.ref.Col - 1
+
+		if r.ref.Line-1 == pos.Line && start <= pos.Character && pos.Character <= start+r.length {
+			return &a.references[idx]
+		}
+	}
+	return nil
+}
+
+func (a *analysis) definition(pos Position) *Location {
+	r := a.referenceAt(pos)
+
+	if nil == r {
+		return nil
+	}
+
+	if r.isImport {
+		return &Location{URI: pathToURI(r.name)}
+	}
+
+	if loc, ok := a.definitions[r.name]; ok {
+		return &Location{URI: pathToURI(loc.Filename), Range: toRange(loc, utf8.RuneCountInString(r.name))}
+	}
+
+	return nil
+}
+
+// shows an entity's resolved fields, including those it inherits
+func (a *analysis) hover(pos Position) *Hover {
+	r := a.referenceAt(pos)
+
+	if nil == r || r.isImport {
+		return nil
+	}
+
+	entry := a.scope.ResolveSymbol(r.name)
+	if nil == entry {
+		return nil
+	}
+
+	entity, ok := entry.Value.(*generator.Generator)
+	if !ok {
+		return nil
+	}
+
+	rng := toRange(r.ref, r.length)
+	return &Hover{Contents: markupContent{Kind: "markdown", Value: "```\n" + entity.Outline(r.name) + "\n```"}, Range: &rng}
+}
+
+// offers dictionary names inside dict(""), and field types otherwise
+func (a *analysis) completion(pos Position) []CompletionItem {
+	lines := strings.Split(a.text, "\n")
+	prefix := ""
+
+	if pos.Line < len(lines) {
+		line := []rune(lines[pos.Line])
+		if pos.Character <= len(line) {
+			prefix = string(line[:pos.Character])
+		}
+	}
+
+	if dictArgPattern.MatchString(prefix) {
+		return a.dictionaryCompletions()
+	}
+
+	items := make([]CompletionItem, 0, len(builtinTypes)+len(a.definitions))
+
+	for _, name := range builtinTypes {
+		items = append(items, CompletionItem{Label: name, Kind: completionKeyword, Detail: "built-in type"})
+	}
+
+	names := make([]string, 0, len(a.definitions))
+	for name := range a.definitions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		kind, detail := completionClass, "entity"
+
+		if entry := a.scope.ResolveSymbol(name); nil != entry && entry.Type != "entity" {
+			detail = entry.Type
+
+			if entry.Type != "template" {
+				kind = completionValue
+			}
+		} else if nil != entry && entry.Value.(*generator.Generator).Abstract() {
+			detail = "abstract entity"
+		}
+
+		items = append(items, CompletionItem{Label: name, Kind: kind, Detail: detail})
+	}
+
+	return items
+}
+
+// formats are referred to without their `_format` suffix, e.g. dict("full_names")
+func (a *analysis) dictionaryCompletions() []CompletionItem {
+	items := make([]CompletionItem, 0)
+
+	entries, err := dictionary.New(filepath.Dir(a.path)).Catalog()
+	if err != nil {
+		return items
+	}
+
+	seen := make(map[string]bool)
+
+	for _, e := range entries {
+		name := strings.TrimSuffix(e.Name, "_format")
+
+		if seen[name] || e.Shadowed {
+			continue
+		}
+		seen[name] = true
+
+		items = append(items, CompletionItem{Label: name, Kind: completionValue, Detail: fmt.Sprintf("%s %s", e.Source, e.Kind())})
+	}
+
+	return items
+}
+
+// keeps the interpreter's warnings, which would otherwise go to stderr, to publish alongside its errors
+type warningCollector struct {
+	logging.DefaultLogger
+	warnings []*dsl.Diagnostic
+}
+
+func (w *warningCollector) Warn(msg string, tokens ...interface{}) {
+	w.warnings = append(w.warnings, dsl.NewWarning("", msg, tokens...))
+}
+
+func (w *warningCollector) WarnDiagnostic(d *dsl.Diagnostic) {
+	w.warnings = append(w.warnings, d)
+}
+
+func toDiagnostic(d *dsl.Diagnostic) Diagnostic {
+	severity := severityError
+	if d.Severity == dsl.SeverityWarning {
+		severity = severityWarning
+	}
+
+	rng := Range{}
+	if nil != d.Ref {
+		rng = toRange(d.Ref, 1)
+	}
+
+	return Diagnostic{Range: rng, Severity: severity, Code: d.Code, Source: "bobcat", Message: d.Msg}
+}
+
+// bobcat locations are 1-based while LSP positions are 0-based
+func toRange(ref *dsl.Location, length int) Range {
+	start := Position{Line: ref.Line - 1, Character: ref.Col - 1}
+	return Range{Start: start, End: Position{Line: start.Line, Character: start.Character + length}}
+}
+
+func pathToURI(path string) string {
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+}
+
+func uriToPath(uri string) string {
+	if u, err := url.Parse(uri); err == nil && u.Scheme == "file" {
+		return filepath.FromSlash(u.Path)
+	}
+	return uri
+}
@@ -0,0 +1,147 @@
+package lsp
+
+import (
+	"fmt"
+	. "github.com/ThoughtWorksStudios/bobcat/test_helpers"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func analyzeTestFile(t *testing.T, name string) *analysis {
+	path, _ := filepath.Abs(filepath.Join("testdata", name))
+	source, err := ioutil.ReadFile(path)
+	AssertNil(t, err, "Didn't expect to get an error: %v", err)
+	return analyze(path, string(source))
+}
+
+func TestAnalyzeReportsNoDiagnosticsForValidSpec(t *testing.T) {
+	a := analyzeTestFile(t, "staff.lang")
+	AssertEqual(t, 1, len(a.diagnostics))
+	AssertEqual(t, 0, len(a.diagnostics[pathToURI(a.path)]))
+}
+
+func TestAnalyzeReportsParseAndSemanticErrors(t *testing.T) {
+	path, _ := filepath.Abs("testdata/unsaved.lang")
+
+	a := analyze(path, "Cat: Animal {\n  name string(3)\n}\n")
+	actual := a.diagnostics[pathToURI(path)]
+	AssertEqual(t, 1, len(actual))
+	AssertEqual(t, "E200", actual[0].Code)
+	AssertEqual(t, Range{Start: Position{0, 0}, End: Position{0, 1}}, actual[0].Range)
+
+	a = analyze(path, "Cat: {\n  name string(3)\n  age integer(1, 2)\n}\n")
+	actual = a.diagnostics[pathToURI(path)]
+	AssertEqual(t, 1, len(actual))
+	AssertEqual(t, severityError, actual[0].Severity)
+}
+
+func TestDefinitionOfEntityIdentifier(t *testing.T) {
+	a := analyzeTestFile(t, "staff.lang")
+	people, _ := filepath.Abs("testdata/people.lang")
+
+	expected := Location{URI: pathToURI(people), Range: Range{Start: Position{0, 0}, End: Position{0, 6}}}
+
+	AssertEqual(t, expected, *a.definition(Position{Line: 2, Character: 12})) // parent entity
+	AssertEqual(t, expected, *a.definition(Position{Line: 4, Character: 10})) // field type
+
+	staff := a.definition(Position{Line: 7, Character: 15}) // generate statement
+	AssertEqual(t, Range{Start: Position{2, 0}, End: Position{2, 8}}, staff.Range)
+	AssertEqual(t, pathToURI(a.path), staff.URI)
+
+	Assert(t, nil == a.definition(Position{Line: 3, Character: 14}), "Should not find a definition for a builtin")
+}
+
+func TestDefinitionOfLetBinding(t *testing.T) {
+	path, _ := filepath.Abs("testdata/unsaved.lang")
+	a := analyze(path, "let AGES = (18, 65)\nPerson: { age integer(AGES) }\ngenerate (1, Person)\n")
+
+	expected := Location{URI: pathToURI(path), Range: Range{Start: Position{0, 4}, End: Position{0, 8}}}
+	AssertEqual(t, expected, *a.definition(Position{Line: 1, Character: 24}))
+
+	labels := make([]string, 0)
+	for _, item := range a.completion(Position{Line: 1, Character: 14}) {
+		labels = append(labels, item.Label+":"+item.Detail)
+	}
+	AssertEqual(t, "AGES:range Person:entity", strings.Join(labels[len(builtinTypes):], " "))
+}
+
+func TestDefinitionOfImport(t *testing.T) {
+	a := analyzeTestFile(t, "staff.lang")
+	people, _ := filepath.Abs("testdata/people.lang")
+
+	AssertEqual(t, Location{URI: pathToURI(people)}, *a.definition(Position{Line: 0, Character: 10}))
+}
+
+func TestHoverShowsInheritedFields(t *testing.T) {
+	a := analyzeTestFile(t, "staff.lang")
+	hover := a.hover(Position{Line: 7, Character: 15})
+
+	expected := strings.Join([]string{
+		"```",
+		"Employee {",
+		"  name     dict  # from Person",
+		"  age      integer",
+		"  manager  Person",
+		"}",
+		"```",
+	}, "\n")
+
+	AssertEqual(t, "markdown", hover.Contents.Kind)
+	AssertEqual(t, expected, hover.Contents.Value)
+	Assert(t, nil == a.hover(Position{Line: 0, Character: 10}), "Should not show anything for imports")
+}
+
+func TestCompletionOffersTypesAndEntities(t *testing.T) {
+	a := analyzeTestFile(t, "staff.lang")
+	labels := make([]string, 0)
+
+	for _, item := range a.completion(Position{Line: 4, Character: 10}) {
+		labels = append(labels, item.Label)
+	}
+
+	AssertEqual(t, "[integer decimal string date dict pick Employee Person]", fmt.Sprintf("%v", labels))
+}
+
+func TestCompletionOffersEveryFieldType(t *testing.T) {
+	grammar, err := ioutil.ReadFile("../dsl/dsl.peg")
+	AssertNil(t, err, "Didn't expect to get an error: %v", err)
+
+	rule := regexp.MustCompile(`(?m)^FieldTypes = (.*)$`).FindSubmatch(grammar)
+	if nil == rule {
+		t.Fatal("Expected dsl.peg to define FieldTypes")
+	}
+
+	offered := make(map[string]bool)
+	for _, item := range analyzeTestFile(t, "staff.lang").completion(Position{Line: 4, Character: 10}) {
+		offered[item.Label] = true
+	}
+
+	for _, fieldType := range regexp.MustCompile(`"(\w+)"`).FindAllStringSubmatch(string(rule[1]), -1) {
+		Assert(t, offered[fieldType[1]], "Expected completion to offer the %q field type", fieldType[1])
+	}
+}
+
+func TestCompletionOffersDictionariesInsideDict(t *testing.T) {
+	path, _ := filepath.Abs("testdata/unsaved.lang")
+	a := analyze(path, "Paint: {\n  color dict(\"co\n}\n")
+
+	found := map[string]CompletionItem{}
+	for _, item := range a.completion(Position{Line: 1, Character: 15}) {
+		found[item.Label] = item
+	}
+
+	AssertEqual(t, "custom dictionary", found["colors"].Detail)
+	AssertEqual(t, "builtin dictionary", found["first_names"].Detail)
+	AssertEqual(t, "builtin format", found["full_names"].Detail)
+
+	_, hasSuffix := found["full_names_format"]
+	Assert(t, !hasSuffix, "Formats should be offered without the _format suffix")
+}
+
+func TestURIConversion(t *testing.T) {
+	AssertEqual(t, "file:///tmp/my%20specs/a.lang", pathToURI("/tmp/my specs/a.lang"))
+	AssertEqual(t, "/tmp/my specs/a.lang", uriToPath("file:///tmp/my%20specs/a.lang"))
+}
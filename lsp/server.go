@@ -0,0 +1,234 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+/**
+ * A Language Server Protocol server for bobcat specs, speaking JSON-RPC over
+ * a pair of streams (normally STDIN/STDOUT). Documents are synced in full, and
+ * re-analyzed on every change.
+ */
+type Server struct {
+	in        *bufio.Reader
+	out       io.Writer
+	documents map[string]*analysis
+	published map[string][]string // URIs that each document has published diagnostics to
+	shutdown  bool
+}
+
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{
+		in:        bufio.NewReader(in),
+		out:       out,
+		documents: make(map[string]*analysis),
+		published: make(map[string][]string),
+	}
+}
+
+/**
+ * Handles messages until the client sends `exit` or closes the input stream. Per
+ * the protocol, the return value is nil only if the client requested a shutdown
+ * beforehand.
+ */
+func (s *Server) Serve() error {
+	for {
+		body, err := s.read()
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return err
+		}
+
+		req := &request{}
+		if err := json.Unmarshal(body, req); err != nil {
+			s.reply(nil, nil, &responseError{Code: codeParseError, Message: err.Error()})
+			continue
+		}
+
+		if req.Method == "exit" {
+			break
+		}
+
+		s.handle(req)
+	}
+
+	if !s.shutdown {
+		return fmt.Errorf("Language server exited without a shutdown request")
+	}
+	return nil
+}
+
+func (s *Server) handle(req *request) {
+	switch req.Method {
+	case "initialize":
+		s.reply(req.ID, initializeResult{
+			Capabilities: serverCapabilities{
+				TextDocumentSync:   textDocumentSyncOptions{OpenClose: true, Change: syncFull, Save: true},
+				DefinitionProvider: true,
+				HoverProvider:      true,
+				CompletionProvider: completionOptions{TriggerCharacters: []string{"\""}},
+			},
+			ServerInfo: serverInfo{Name: "bobcat"},
+		}, nil)
+	case "shutdown":
+		s.shutdown = true
+		s.reply(req.ID, nil, nil)
+	case "textDocument/didOpen":
+		params := &didOpenParams{}
+		if s.decode(req, params) {
+			s.update(params.TextDocument.URI, params.TextDocument.Text)
+		}
+	case "textDocument/didChange":
+		params := &didChangeParams{}
+		if s.decode(req, params) && len(params.ContentChanges) > 0 {
+			s.update(params.TextDocument.URI, params.ContentChanges[len(params.ContentChanges)-1].Text)
+		}
+	case "textDocument/didSave":
+		params := &didSaveParams{}
+		if s.decode(req, params) && nil != params.Text {
+			s.update(params.TextDocument.URI, *params.Text)
+		}
+
+		// any open document may import the one that was saved
+		for uri, doc := range s.documents {
+			s.update(uri, doc.text)
+		}
+	case "textDocument/didClose":
+		params := &didCloseParams{}
+		if s.decode(req, params) {
+			s.close(params.TextDocument.URI)
+		}
+	case "textDocument/definition":
+		if doc, params := s.documentAt(req); nil != doc {
+			s.reply(req.ID, doc.definition(params.Position), nil)
+		}
+	case "textDocument/hover":
+		if doc, params := s.documentAt(req); nil != doc {
+			s.reply(req.ID, doc.hover(params.Position), nil)
+		}
+	case "textDocument/completion":
+		if doc, params := s.documentAt(req); nil != doc {
+			s.reply(req.ID, doc.completion(params.Position), nil)
+		}
+	default:
+		// notifications we don't understand (e.g. `initialized`) are safe to ignore
+		if nil != req.ID {
+			s.reply(req.ID, nil, &responseError{Code: codeMethodNotFound, Message: fmt.Sprintf("Unsupported method %q", req.Method)})
+		}
+	}
+}
+
+func (s *Server) decode(req *request, params interface{}) bool {
+	if err := json.Unmarshal(req.Params, params); err != nil {
+		if nil != req.ID {
+			s.reply(req.ID, nil, &responseError{Code: codeInvalidParams, Message: err.Error()})
+		}
+		return false
+	}
+	return true
+}
+
+// replies with null for documents that were never opened
+func (s *Server) documentAt(req *request) (*analysis, *textDocumentPositionParams) {
+	params := &textDocumentPositionParams{}
+
+	if !s.decode(req, params) {
+		return nil, nil
+	}
+
+	doc, ok := s.documents[params.TextDocument.URI]
+	if !ok {
+		s.reply(req.ID, nil, nil)
+		return nil, nil
+	}
+
+	return doc, params
+}
+
+func (s *Server) update(uri, text string) {
+	doc := analyze(uriToPath(uri), text)
+	s.documents[uri] = doc
+
+	// clear diagnostics previously published for files that no longer have problems
+	for _, target := range s.published[uri] {
+		if _, stillPublished := doc.diagnostics[target]; !stillPublished {
+			s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{URI: target, Diagnostics: []Diagnostic{}})
+		}
+	}
+
+	targets := make([]string, 0, len(doc.diagnostics))
+
+	for target, diagnostics := range doc.diagnostics {
+		s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{URI: target, Diagnostics: diagnostics})
+		targets = append(targets, target)
+	}
+
+	s.published[uri] = targets
+}
+
+func (s *Server) close(uri string) {
+	for _, target := range s.published[uri] {
+		s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{URI: target, Diagnostics: []Diagnostic{}})
+	}
+
+	delete(s.documents, uri)
+	delete(s.published, uri)
+}
+
+func (s *Server) reply(id *json.RawMessage, result interface{}, err *responseError) {
+	s.write(response{JSONRPC: "2.0", ID: id, Result: result, Error: err})
+}
+
+func (s *Server) notify(method string, params interface{}) {
+	s.write(notification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+// reads a single message body, framed by a Content-Length header
+func (s *Server) read() ([]byte, error) {
+	length := -1
+
+	for {
+		line, err := s.in.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+
+		line = strings.TrimSpace(line)
+
+		if line == "" {
+			break
+		}
+
+		if strings.HasPrefix(strings.ToLower(line), "content-length:") {
+			if length, err = strconv.Atoi(strings.TrimSpace(line[len("content-length:"):])); err != nil {
+				return nil, fmt.Errorf("Invalid Content-Length header %q", line)
+			}
+		}
+	}
+
+	if length < 0 {
+		return nil, fmt.Errorf("Message is missing a Content-Length header")
+	}
+
+	body := make([]byte, length)
+	_, err := io.ReadFull(s.in, body)
+	return body, err
+}
+
+func (s *Server) write(message interface{}) {
+	body, err := json.Marshal(message)
+	if err != nil {
+		return
+	}
+
+	fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n%s", len(body), body)
+}
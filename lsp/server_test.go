@@ -0,0 +1,112 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	. "github.com/ThoughtWorksStudios/bobcat/test_helpers"
+	"path/filepath"
+	"testing"
+)
+
+func frame(messages ...string) *bytes.Buffer {
+	buf := &bytes.Buffer{}
+	for _, m := range messages {
+		fmt.Fprintf(buf, "Content-Length: %d\r\n\r\n%s", len(m), m)
+	}
+	return buf
+}
+
+func readAll(t *testing.T, out *bytes.Buffer) []map[string]interface{} {
+	s := NewServer(out, nil)
+	messages := make([]map[string]interface{}, 0)
+
+	for {
+		body, err := s.read()
+		if err != nil {
+			break
+		}
+
+		message := make(map[string]interface{})
+		AssertNil(t, json.Unmarshal(body, &message), "Expected valid JSON: %s", body)
+		messages = append(messages, message)
+	}
+
+	return messages
+}
+
+func TestServerLifecycle(t *testing.T) {
+	path, _ := filepath.Abs("testdata/unsaved.lang")
+	uri := pathToURI(path)
+	out := &bytes.Buffer{}
+
+	in := frame(
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`,
+		`{"jsonrpc":"2.0","method":"initialized","params":{}}`,
+		fmt.Sprintf(`{"jsonrpc":"2.0","method":"textDocument/didOpen","params":{"textDocument":{"uri":%q,"text":"Cat: Animal {}"}}}`, uri),
+		fmt.Sprintf(`{"jsonrpc":"2.0","method":"textDocument/didChange","params":{"textDocument":{"uri":%q},"contentChanges":[{"text":"Cat: {}"}]}}`, uri),
+		fmt.Sprintf(`{"jsonrpc":"2.0","id":2,"method":"textDocument/hover","params":{"textDocument":{"uri":%q},"position":{"line":0,"character":1}}}`, uri),
+		`{"jsonrpc":"2.0","id":3,"method":"workspace/symbol","params":{}}`,
+		`{"jsonrpc":"2.0","id":4,"method":"shutdown"}`,
+		`{"jsonrpc":"2.0","method":"exit"}`,
+	)
+
+	AssertNil(t, NewServer(in, out).Serve(), "Expected a clean exit")
+
+	messages := readAll(t, out)
+	AssertEqual(t, 6, len(messages))
+
+	capabilities := messages[0]["result"].(map[string]interface{})["capabilities"].(map[string]interface{})
+	AssertEqual(t, true, capabilities["hoverProvider"])
+
+	AssertEqual(t, "textDocument/publishDiagnostics", messages[1]["method"])
+	AssertEqual(t, 1, len(messages[1]["params"].(map[string]interface{})["diagnostics"].([]interface{})))
+	AssertEqual(t, 0, len(messages[2]["params"].(map[string]interface{})["diagnostics"].([]interface{})))
+
+	hover := messages[3]["result"].(map[string]interface{})["contents"].(map[string]interface{})
+	AssertEqual(t, "```\nCat {\n}\n```", hover["value"])
+
+	AssertEqual(t, float64(codeMethodNotFound), messages[4]["error"].(map[string]interface{})["code"])
+	AssertEqual(t, float64(4), messages[5]["id"])
+}
+
+func TestServerPublishesWarnings(t *testing.T) {
+	path, _ := filepath.Abs("testdata/unsaved.lang")
+	out := &bytes.Buffer{}
+
+	in := frame(
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`,
+		fmt.Sprintf(`{"jsonrpc":"2.0","method":"textDocument/didOpen","params":{"textDocument":{"uri":%q,"text":"Person: {\n  friend Person\n}\nCat: {}\nZoo: { cats Cat(2) }"}}}`, pathToURI(path)),
+		`{"jsonrpc":"2.0","id":2,"method":"shutdown"}`,
+		`{"jsonrpc":"2.0","method":"exit"}`,
+	)
+
+	AssertNil(t, NewServer(in, out).Serve(), "Expected a clean exit")
+
+	messages := readAll(t, out)
+	AssertEqual(t, "textDocument/publishDiagnostics", messages[1]["method"])
+
+	diagnostics := messages[1]["params"].(map[string]interface{})["diagnostics"].([]interface{})
+	AssertEqual(t, 2, len(diagnostics))
+
+	nesting := diagnostics[0].(map[string]interface{})
+	AssertEqual(t, "W303", nesting["code"])
+	AssertEqual(t, float64(severityWarning), nesting["severity"])
+	AssertEqual(t, float64(0), nesting["range"].(map[string]interface{})["start"].(map[string]interface{})["line"])
+
+	deprecated := diagnostics[1].(map[string]interface{})
+	AssertEqual(t, "W307", deprecated["code"])
+	AssertEqual(t, float64(severityWarning), deprecated["severity"])
+	AssertEqual(t, float64(4), deprecated["range"].(map[string]interface{})["start"].(map[string]interface{})["line"])
+}
+
+func TestServerRequiresShutdownBeforeExit(t *testing.T) {
+	ExpectsError(t, "Language server exited without a shutdown request", NewServer(frame(`{"jsonrpc":"2.0","method":"exit"}`), &bytes.Buffer{}).Serve())
+}
+
+func TestServerRejectsUnframedInput(t *testing.T) {
+	s := &Server{in: bufio.NewReader(bytes.NewBufferString("{}\r\n\r\n"))}
+	_, err := s.read()
+	ExpectsError(t, "Message is missing a Content-Length header", err)
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"github.com/ThoughtWorksStudios/bobcat/lsp"
+	"log"
+	"os"
+)
+
+// serves the Language Server Protocol over STDIN/STDOUT, so nothing else may write to STDOUT
+func runLspCommand(args []string) {
+	if len(args) > 0 {
+		log.Print("Usage: ./bobcat lsp")
+		os.Exit(1)
+	}
+
+	if err := lsp.NewServer(os.Stdin, os.Stdout).Serve(); err != nil {
+		log.Fatalln(err)
+	}
+}
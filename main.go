@@ -1,11 +1,17 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
+	"fmt"
+	"github.com/ThoughtWorksStudios/bobcat/dsl"
+	"github.com/ThoughtWorksStudios/bobcat/generator"
 	"github.com/ThoughtWorksStudios/bobcat/interpreter"
 	"log"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strings"
 )
 
 func init() {
@@ -17,16 +23,79 @@ func printHelpAndExit() {
 	os.Exit(1)
 }
 
+// writes diagnostics as a JSON array to STDOUT for editors and CI; an empty array means success
+func printDiagnostics(diagnostics []*dsl.Diagnostic) {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+
+	if err := encoder.Encode(diagnostics); err != nil {
+		log.Fatalln(err)
+	}
+}
+
+// -set may be given more than once, e.g. -set users=100000 -set region=eu
+type parameters []string
+
+func (p *parameters) String() string {
+	return strings.Join(*p, " ")
+}
+
+func (p *parameters) Set(value string) error {
+	if !strings.Contains(value, "=") {
+		return fmt.Errorf("expected name=value, e.g. users=100000")
+	}
+
+	*p = append(*p, value)
+	return nil
+}
+
+// a -set that no `let` statement uses is most likely a typo
+func warnUnassigned(i *interpreter.Interpreter) {
+	for _, name := range i.UnassignedParameters() {
+		log.Printf("-set %s has no effect, as the spec has no `let %s` statement", name, name)
+	}
+}
+
+// subcommands are dispatched on the first argument; anything else is treated as a spec file
+var subcommands = map[string]func(args []string){
+	"dict": runDictCommand,
+	"fmt":  runFmtCommand,
+	"lint": runLintCommand,
+	"lsp":  runLspCommand,
+	"repl": runReplCommand,
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		if command, ok := subcommands[os.Args[1]]; ok {
+			command(os.Args[2:])
+			return
+		}
+	}
+
 	flag.CommandLine.Usage = func() {
 		log.Print("Usage: ./bobcat [ options ] spec_file.lang")
+		log.Print("       ./bobcat dict [ list | sample | validate ] ...")
+		log.Print("       ./bobcat fmt [ -w | -d ] [ spec_file.lang ... ]")
+		log.Print("       ./bobcat lint [ -d custom_dict_dir ] [ -diagnostics json ] spec_file.lang")
+		log.Print("       ./bobcat lsp")
+		log.Print("       ./bobcat repl [ -d custom_dict_dir ]")
 		log.Print("\nOptions:")
 		flag.CommandLine.PrintDefaults()
 	}
 	outputFile := flag.CommandLine.String("dest", "entities.json", "Destination file for generated content (NOTE that -dest and -split-output are mutually exclusize; the -dest flag will be ignored)")
 	filePerEntity := flag.CommandLine.Bool("split-output", false, "Create a seperate output file per definition with the filename being the definition's name. (NOTE that -split-output and -dest are mutually exclusize; the -dest flag will be ignored)")
-	syntaxCheck := flag.CommandLine.Bool("c", false, "Checks the syntax of the provided spec")
+	syntaxCheck := flag.CommandLine.Bool("c", false, "Checks the provided spec for syntax and semantic errors without generating any data")
 	customDicts := flag.CommandLine.String("d", "", "location of custom dictionary files ( e.g. ./bobcat -d=~/data/ examples/example.lang )")
+	diagnostics := flag.CommandLine.String("diagnostics", "text", "Format of reported errors: `text` for humans, or `json` for tools")
+	maxDepth := flag.CommandLine.Int("max-depth", generator.DefaultNestingLimit().MaxDepth, "How many levels deep an entity may nest itself (e.g. a Person with a Person friend field) before the nesting is cut off")
+	truncate := flag.CommandLine.String("truncate", generator.TruncateWithNull, "What replaces entities nested beyond -max-depth: `null` (or an empty array for multi-value fields), or reference to the $id of the closest ancestor of the same type")
+	workers := flag.CommandLine.Int("workers", runtime.NumCPU(), "How many goroutines generate the entities of each generate statement; the output is the same for any number")
+	sortFields := flag.CommandLine.Bool("sort-fields", false, "Write each entity's fields in alphabetical order, rather than metadata first and then the order they were declared in")
+	seed := flag.CommandLine.Int64("seed", 0, "Seeds the random values so that the same spec always generates the same output; by default, every run differs")
+	settings := &parameters{}
+	flag.CommandLine.Var(settings, "set", "Sets `name=value`, replacing the value of the spec's `let name = ...` statement, e.g. -set users=100000; may be given more than once")
+	scale := flag.CommandLine.Float64("scale", 1, "Multiplies the count of every generate statement, e.g. 0.01 to generate 1% as many entities (never fewer than 1)")
 
 	//everything except the executable itself
 	flag.CommandLine.Parse(os.Args[1:])
@@ -37,10 +106,48 @@ func main() {
 		printHelpAndExit()
 	}
 
+	if *diagnostics != "text" && *diagnostics != "json" {
+		log.Printf("Unknown diagnostics format %q", *diagnostics)
+		printHelpAndExit()
+	}
+
+	jsonDiagnostics := *diagnostics == "json"
 	filename := flag.CommandLine.Args()[0]
 
 	i := interpreter.New()
 
+	if err := i.SetNestingLimit(generator.NestingLimit{MaxDepth: *maxDepth, Truncate: *truncate}); err != nil {
+		log.Print(err)
+		printHelpAndExit()
+	}
+
+	if err := i.SetWorkers(*workers); err != nil {
+		log.Print(err)
+		printHelpAndExit()
+	}
+
+	i.SetSortFields(*sortFields)
+
+	for _, setting := range *settings {
+		parts := strings.SplitN(setting, "=", 2)
+
+		if err := i.SetParameter(parts[0], parts[1]); err != nil {
+			log.Print(err)
+			printHelpAndExit()
+		}
+	}
+
+	if err := i.SetScale(*scale); err != nil {
+		log.Print(err)
+		printHelpAndExit()
+	}
+
+	flag.CommandLine.Visit(func(f *flag.Flag) {
+		if f.Name == "seed" {
+			i.SetSeed(*seed)
+		}
+	})
+
 	if *customDicts == "" {
 		a, _ := filepath.Abs(filename)
 		i.SetCustomDictonaryPath(filepath.Dir(a))
@@ -49,19 +156,42 @@ func main() {
 	}
 
 	if *syntaxCheck {
-		if errors := i.CheckFile(filename); errors != nil {
-			log.Fatalf("Syntax check failed: %v\n", errors)
+		errors := i.CheckFile(filename)
+
+		if nil == errors && !jsonDiagnostics {
+			warnUnassigned(i)
 		}
 
-		log.Println("Syntax OK")
+		if jsonDiagnostics {
+			printDiagnostics(interpreter.Diagnostics(errors))
+		} else if errors != nil {
+			log.Printf("Check failed:\n\n%s\n", interpreter.RenderErrors(errors))
+		} else {
+			log.Println("Spec OK")
+		}
+
+		if errors != nil {
+			os.Exit(1)
+		}
 		os.Exit(0)
 	}
 
+	stream := interpreter.NewOutputStream(*outputFile, *filePerEntity)
+	i.StreamTo(stream)
+
 	if errors := i.LoadFile(filename, interpreter.NewRootScope()); errors != nil {
-		log.Fatalln(errors)
+		stream.Discard()
+
+		if jsonDiagnostics {
+			printDiagnostics(interpreter.Diagnostics(errors))
+			os.Exit(1)
+		}
+		log.Fatalln(interpreter.RenderErrors(errors))
 	}
 
-	if errors := i.WriteGeneratedContent(*outputFile, *filePerEntity); errors != nil {
+	if errors := stream.Close(); errors != nil {
 		log.Fatalln(errors)
 	}
+
+	warnUnassigned(i)
 }
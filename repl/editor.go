@@ -0,0 +1,278 @@
+package repl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// returned by ReadLine() when the user presses Ctrl-C, abandoning the line
+var ErrInterrupted = errors.New("Interrupted")
+
+// the most lines kept in the history
+const historyLimit = 1000
+
+// control characters
+const (
+	keyCtrlA     = 1
+	keyCtrlB     = 2
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyCtrlE     = 5
+	keyCtrlF     = 6
+	keyBackspace = 8
+	keyTab       = 9
+	keyCtrlK     = 11
+	keyCtrlL     = 12
+	keyEnter     = 13
+	keyCtrlN     = 14
+	keyCtrlP     = 16
+	keyCtrlU     = 21
+	keyCtrlW     = 23
+	keyEscape    = 27
+	keyDelete    = 127
+)
+
+/**
+ * A minimal line editor for VT100-compatible terminals, supporting cursor
+ * movement, the common Emacs-style shortcuts, and history (with the up and
+ * down arrows). Wide characters are assumed to take up one column.
+ */
+type Editor struct {
+	in      *bufio.Reader
+	out     io.Writer
+	history []string
+	raw     func() (func(), error) // switches the terminal to raw mode, returning a function to restore it
+}
+
+// an editor for input that has already been put into raw mode
+func NewEditor(in io.Reader, out io.Writer) *Editor {
+	return &Editor{in: bufio.NewReader(in), out: out, history: make([]string, 0)}
+}
+
+func (e *Editor) History() []string {
+	return e.history
+}
+
+func (e *Editor) SetHistory(lines []string) {
+	e.history = make([]string, 0, len(lines))
+	for _, line := range lines {
+		e.AddHistory(line)
+	}
+}
+
+// blank lines, and lines that repeat the previous one, are not recorded
+func (e *Editor) AddHistory(line string) {
+	if strings.TrimSpace(line) == "" || (len(e.history) > 0 && e.history[len(e.history)-1] == line) {
+		return
+	}
+
+	e.history = append(e.history, line)
+
+	if len(e.history) > historyLimit {
+		e.history = e.history[len(e.history)-historyLimit:]
+	}
+}
+
+// a line being edited, along with where it sits in the history
+type lineState struct {
+	prompt  []rune
+	buf     []rune
+	pos     int
+	entry   int    // the history entry being shown; len(history) is the new line
+	current string // the new line, saved while browsing the history
+}
+
+/**
+ * Reads a line after showing the prompt, and records it in the history. Returns
+ * io.EOF when Ctrl-D is pressed on an empty line, and ErrInterrupted when Ctrl-C
+ * is pressed.
+ */
+func (e *Editor) ReadLine(prompt string) (string, error) {
+	if nil != e.raw {
+		restore, err := e.raw()
+		if err != nil {
+			return "", err
+		}
+		defer restore()
+	}
+
+	s := &lineState{prompt: []rune(prompt), buf: make([]rune, 0), entry: len(e.history)}
+	e.refresh(s)
+
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			if err == io.EOF && len(s.buf) > 0 {
+				return e.accept(s), nil
+			}
+			return "", err
+		}
+
+		switch r {
+		case keyEnter, '\n':
+			return e.accept(s), nil
+		case keyCtrlC:
+			e.write("^C\r\n")
+			return "", ErrInterrupted
+		case keyCtrlD:
+			if len(s.buf) == 0 {
+				e.write("\r\n")
+				return "", io.EOF
+			}
+			s.deleteForward()
+		case keyBackspace, keyDelete:
+			s.deleteBackward()
+		case keyCtrlA:
+			s.pos = 0
+		case keyCtrlE:
+			s.pos = len(s.buf)
+		case keyCtrlB:
+			s.moveBy(-1)
+		case keyCtrlF:
+			s.moveBy(1)
+		case keyCtrlK:
+			s.buf = s.buf[:s.pos]
+		case keyCtrlU:
+			s.buf, s.pos = s.buf[s.pos:], 0
+		case keyCtrlW:
+			s.deleteWord()
+		case keyCtrlP:
+			e.browse(s, -1)
+		case keyCtrlN:
+			e.browse(s, 1)
+		case keyCtrlL:
+			e.write("\x1b[H\x1b[2J")
+		case keyTab:
+			s.insert(' ', ' ')
+		case keyEscape:
+			e.escape(s)
+		default:
+			if r >= ' ' {
+				s.insert(r)
+			}
+		}
+
+		e.refresh(s)
+	}
+}
+
+func (e *Editor) accept(s *lineState) string {
+	e.write("\r\n")
+	e.AddHistory(string(s.buf))
+	return string(s.buf)
+}
+
+// handles the escape sequences sent by arrow, home, end, and delete keys; anything else is ignored
+func (e *Editor) escape(s *lineState) {
+	next, _, err := e.in.ReadRune()
+	if err != nil || (next != '[' && next != 'O') {
+		return
+	}
+
+	code, _, err := e.in.ReadRune()
+	if err != nil {
+		return
+	}
+
+	// e.g. ESC [ 3 ~ for delete
+	if code >= '0' && code <= '9' {
+		if tilde, _, err := e.in.ReadRune(); err != nil || tilde != '~' {
+			return
+		}
+	}
+
+	switch code {
+	case 'A':
+		e.browse(s, -1)
+	case 'B':
+		e.browse(s, 1)
+	case 'C':
+		s.moveBy(1)
+	case 'D':
+		s.moveBy(-1)
+	case 'H', '1', '7':
+		s.pos = 0
+	case 'F', '4', '8':
+		s.pos = len(s.buf)
+	case '3':
+		s.deleteForward()
+	}
+}
+
+func (e *Editor) browse(s *lineState, delta int) {
+	entry := s.entry + delta
+
+	if entry < 0 || entry > len(e.history) {
+		return
+	}
+
+	if s.entry == len(e.history) {
+		s.current = string(s.buf)
+	}
+
+	s.entry = entry
+
+	if entry == len(e.history) {
+		s.buf = []rune(s.current)
+	} else {
+		s.buf = []rune(e.history[entry])
+	}
+
+	s.pos = len(s.buf)
+}
+
+// redraws the whole line, then moves the cursor back into place
+func (e *Editor) refresh(s *lineState) {
+	e.write(fmt.Sprintf("\r%s%s\x1b[K\r", string(s.prompt), string(s.buf)))
+
+	if column := len(s.prompt) + s.pos; column > 0 {
+		e.write(fmt.Sprintf("\x1b[%dC", column))
+	}
+}
+
+func (e *Editor) write(s string) {
+	io.WriteString(e.out, s)
+}
+
+func (s *lineState) insert(runes ...rune) {
+	buf := make([]rune, 0, len(s.buf)+len(runes))
+	buf = append(append(append(buf, s.buf[:s.pos]...), runes...), s.buf[s.pos:]...)
+	s.buf, s.pos = buf, s.pos+len(runes)
+}
+
+func (s *lineState) moveBy(delta int) {
+	if pos := s.pos + delta; pos >= 0 && pos <= len(s.buf) {
+		s.pos = pos
+	}
+}
+
+func (s *lineState) deleteBackward() {
+	if s.pos > 0 {
+		s.buf = append(s.buf[:s.pos-1], s.buf[s.pos:]...)
+		s.pos--
+	}
+}
+
+func (s *lineState) deleteForward() {
+	if s.pos < len(s.buf) {
+		s.buf = append(s.buf[:s.pos], s.buf[s.pos+1:]...)
+	}
+}
+
+// deletes back to the start of the previous word, like most shells
+func (s *lineState) deleteWord() {
+	start := s.pos
+
+	for start > 0 && s.buf[start-1] == ' ' {
+		start--
+	}
+
+	for start > 0 && s.buf[start-1] != ' ' {
+		start--
+	}
+
+	s.buf, s.pos = append(s.buf[:start], s.buf[s.pos:]...), start
+}
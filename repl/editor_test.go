@@ -0,0 +1,55 @@
+package repl
+
+import (
+	"bytes"
+	. "github.com/ThoughtWorksStudios/bobcat/test_helpers"
+	"io"
+	"strings"
+	"testing"
+)
+
+func readLine(t *testing.T, e *Editor, keys string) string {
+	line, err := e.ReadLine("> ")
+	AssertNil(t, err, "Didn't expect an error reading %q: %v", keys, err)
+	return line
+}
+
+func editor(keys string) *Editor {
+	return NewEditor(strings.NewReader(keys), &bytes.Buffer{})
+}
+
+func TestEditingKeys(t *testing.T) {
+	// left arrow, then insert
+	AssertEqual(t, "abxc", readLine(t, editor("abc\x1b[Dx\r"), ""))
+
+	// home, delete key, and end
+	AssertEqual(t, "acd", readLine(t, editor("bc\x01a\x1b[3~\x05d\r"), ""))
+
+	// backspace, Ctrl-W, Ctrl-U, and Ctrl-K
+	AssertEqual(t, "one", readLine(t, editor("onx\x7fe two\x17\x7f\r"), ""))
+	AssertEqual(t, "keep", readLine(t, editor("drop keep\x01\x1b[C\x1b[C\x1b[C\x1b[C\x1b[C\x15\r"), ""))
+	AssertEqual(t, "keep", readLine(t, editor("keep drop\x01\x06\x06\x06\x06\x0b\r"), ""))
+}
+
+func TestHistory(t *testing.T) {
+	e := editor("first\rsecond\r\r\x1b[A\x1b[A\x1b[B!\rnew\x10\x0e\r")
+	e.SetHistory([]string{"older"})
+
+	AssertEqual(t, "first", readLine(t, e, ""))
+	AssertEqual(t, "second", readLine(t, e, ""))
+	AssertEqual(t, "", readLine(t, e, ""))
+	AssertEqual(t, "second!", readLine(t, e, ""))
+	AssertEqual(t, "new", readLine(t, e, ""))
+
+	AssertEqual(t, "older first second second! new", strings.Join(e.History(), " "))
+}
+
+func TestInterruptAndEndOfInput(t *testing.T) {
+	e := editor("abc\x03\x04")
+
+	_, err := e.ReadLine("> ")
+	AssertEqual(t, ErrInterrupted, err)
+
+	_, err = e.ReadLine("> ")
+	AssertEqual(t, io.EOF, err)
+}
@@ -0,0 +1,279 @@
+package repl
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/ThoughtWorksStudios/bobcat/dsl"
+	"github.com/ThoughtWorksStudios/bobcat/generator"
+	"github.com/ThoughtWorksStudios/bobcat/interpreter"
+	"github.com/ThoughtWorksStudios/bobcat/logging"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	prompt         = "bobcat> "
+	continuePrompt = "    ... "
+
+	// errors in the input are reported as coming from this file
+	inputFilename = "<repl>"
+)
+
+const helpText = `Enter definitions, imports, and generate statements just as in a spec; a
+statement may span several lines until its braces and parentheses are closed.
+
+Commands:
+  :sample <entity> [count]  print generated entities, e.g. :sample Person 3
+  :show [entity]            print an entity's resolved fields, or list all entities
+  :reset                    forget all definitions and imports
+  :help                     show this message
+  :quit                     exit (or press Ctrl-D)`
+
+// the count at the end of a :sample command, e.g. `:sample Person { age 3 } 2`
+var sampleCountPattern = regexp.MustCompile(`\s+(\d+)$`)
+
+type LineReader interface {
+	ReadLine(prompt string) (string, error)
+}
+
+/**
+ * Keeps an interpreter and its root scope alive between inputs, so that
+ * definitions accumulate as they are entered
+ */
+type Session struct {
+	interpreter *interpreter.Interpreter
+	scope       *interpreter.Scope
+	out         io.Writer
+	pending     []string // the lines of an unfinished statement
+}
+
+func NewSession(i *interpreter.Interpreter, out io.Writer) *Session {
+	i.SetLogger(&sessionLogger{out: out})
+	return &Session{interpreter: i, scope: interpreter.NewRootScope(), out: out, pending: make([]string, 0)}
+}
+
+// evaluates each line that is read until the input ends or the user quits
+func (s *Session) Run(in LineReader) error {
+	for {
+		line, err := in.ReadLine(s.Prompt())
+
+		switch err {
+		case nil:
+			if !s.Eval(line) {
+				return nil
+			}
+		case ErrInterrupted:
+			s.pending = s.pending[:0]
+		case io.EOF:
+			return nil
+		default:
+			return err
+		}
+	}
+}
+
+func (s *Session) Prompt() string {
+	if len(s.pending) > 0 {
+		return continuePrompt
+	}
+	return prompt
+}
+
+// handles a line of input, returning false when the user asks to quit
+func (s *Session) Eval(line string) bool {
+	trimmed := strings.TrimSpace(line)
+
+	if len(s.pending) == 0 && strings.HasPrefix(trimmed, ":") {
+		return s.command(trimmed)
+	}
+
+	s.pending = append(s.pending, line)
+	source := strings.Join(s.pending, "\n")
+
+	if !complete(source) {
+		return true
+	}
+
+	s.pending = s.pending[:0]
+
+	if strings.TrimSpace(source) != "" {
+		s.evaluate(source)
+	}
+
+	return true
+}
+
+func (s *Session) command(input string) bool {
+	name, args := input, ""
+
+	if idx := strings.IndexAny(input, " \t"); idx > 0 {
+		name, args = input[:idx], strings.TrimSpace(input[idx:])
+	}
+
+	switch name {
+	case ":quit", ":q", ":exit":
+		return false
+	case ":help", ":h":
+		s.println(helpText)
+	case ":sample", ":s":
+		s.sample(args)
+	case ":show":
+		s.show(args)
+	case ":reset":
+		s.scope = interpreter.NewRootScope()
+	default:
+		s.println(fmt.Sprintf("Unknown command %q; type :help for a list of commands", name))
+	}
+
+	return true
+}
+
+// any entity expression that generate() accepts may be sampled, including inline ones
+func (s *Session) sample(args string) {
+	count := int64(1)
+
+	if match := sampleCountPattern.FindStringSubmatch(args); nil != match {
+		count, _ = strconv.ParseInt(match[1], 10, 64)
+		args = strings.TrimSpace(args[:len(args)-len(match[0])])
+	}
+
+	if args == "" {
+		s.println("Usage: :sample <entity> [count]")
+		return
+	}
+
+	s.evaluate(fmt.Sprintf("generate (%d, %s)", count, args))
+}
+
+func (s *Session) show(args string) {
+	names := strings.Fields(args)
+
+	if len(names) == 0 {
+		for _, name := range s.scope.Names() {
+			if _, isEntity := s.entity(name); isEntity {
+				names = append(names, name)
+			}
+		}
+
+		if len(names) == 0 {
+			s.println("No entities have been defined yet")
+		} else {
+			s.println(strings.Join(names, "\n"))
+		}
+		return
+	}
+
+	for _, name := range names {
+		if entity, ok := s.entity(name); ok {
+			s.println(entity.Outline(name))
+		} else {
+			s.println(fmt.Sprintf("Cannot resolve entity %q", name))
+		}
+	}
+}
+
+/**
+ * Loads the source into the session's scope, then prints any errors, the
+ * entities that were generated, and the definitions that were added or replaced.
+ * Input with errors leaves the scope as it was, so half-built definitions are
+ * neither shown nor kept
+ */
+func (s *Session) evaluate(source string) {
+	before := s.scope.Symbols()
+
+	if err := s.interpreter.LoadReader(inputFilename, strings.NewReader(source), s.scope); err != nil {
+		for _, d := range interpreter.Diagnostics(err) {
+			s.println(dsl.RenderSource(d, inputFilename, []byte(source)))
+		}
+		s.scope.Restore(before)
+	}
+
+	if err := s.interpreter.FlushGeneratedContent(s.out); err != nil {
+		s.println(err.Error())
+	}
+
+	for _, name := range s.scope.Names() {
+		if entity, ok := s.entity(name); ok && before[name] != s.scope.ResolveSymbol(name) {
+			s.println(entity.Outline(name))
+		}
+	}
+}
+
+// anonymous entities are given $-prefixed names, which aren't worth showing
+func (s *Session) entity(name string) (*generator.Generator, bool) {
+	if entry := s.scope.ResolveSymbol(name); nil != entry && !strings.HasPrefix(name, "$") {
+		entity, ok := entry.Value.(*generator.Generator)
+		return entity, ok
+	}
+	return nil, false
+}
+
+func (s *Session) println(text string) {
+	fmt.Fprintln(s.out, text)
+}
+
+/**
+ * Whether the source has closed all of its braces, brackets, and parentheses,
+ * ignoring any within strings and comments. Unbalanced closing characters count
+ * as complete, so that the interpreter can report them.
+ */
+func complete(source string) bool {
+	depth := 0
+	inString, inComment, escaped := false, false, false
+
+	for _, r := range source {
+		switch {
+		case inComment:
+			inComment = r != '\n'
+		case inString:
+			if escaped {
+				escaped = false
+			} else if r == '\\' {
+				escaped = true
+			} else if r == '"' || r == '\n' {
+				inString = false
+			}
+		case r == '#':
+			inComment = true
+		case r == '"':
+			inString = true
+		case r == '{' || r == '(' || r == '[':
+			depth++
+		case r == '}' || r == ')' || r == ']':
+			depth--
+		}
+	}
+
+	return depth <= 0
+}
+
+// reads input that isn't from a terminal, e.g. when piped in, without echoing prompts
+type lineScanner struct {
+	in *bufio.Reader
+}
+
+func Lines(in io.Reader) LineReader {
+	return &lineScanner{in: bufio.NewReader(in)}
+}
+
+func (l *lineScanner) ReadLine(prompt string) (string, error) {
+	line, err := l.in.ReadString('\n')
+
+	if err == io.EOF && line != "" {
+		return line, nil
+	}
+
+	return strings.TrimRight(line, "\r\n"), err
+}
+
+// warnings are part of the session's output, rather than going to STDERR
+type sessionLogger struct {
+	logging.DefaultLogger
+	out io.Writer
+}
+
+func (l *sessionLogger) Warn(msg string, tokens ...interface{}) {
+	fmt.Fprintln(l.out, fmt.Sprintf(msg, tokens...))
+}
@@ -0,0 +1,136 @@
+package repl
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/ThoughtWorksStudios/bobcat/interpreter"
+	. "github.com/ThoughtWorksStudios/bobcat/test_helpers"
+	"strings"
+	"testing"
+)
+
+func session() (*Session, *bytes.Buffer) {
+	out := &bytes.Buffer{}
+	return NewSession(interpreter.New(), out), out
+}
+
+func TestDefinitionsAccumulateAcrossInputs(t *testing.T) {
+	s, out := session()
+
+	Assert(t, s.Eval(`Person: {`), "Expected the session to continue")
+	AssertEqual(t, continuePrompt, s.Prompt())
+	AssertEqual(t, "", out.String())
+
+	s.Eval(`  name "frank"`)
+	s.Eval(`}`)
+	AssertEqual(t, prompt, s.Prompt())
+	AssertEqual(t, "Person {\n  name  literal\n}\n", out.String())
+
+	out.Reset()
+	s.Eval(`Employee: Person { salary integer(1, 10) }`)
+	AssertEqual(t, "Employee {\n  name    literal  # from Person\n  salary  integer\n}\n", out.String())
+}
+
+func TestSamplePrintsGeneratedEntities(t *testing.T) {
+	s, out := session()
+	s.Eval(`Person: { name "frank" }`)
+	out.Reset()
+
+	s.Eval(`:sample Person 3`)
+
+	result := make(map[string][]map[string]interface{})
+	AssertNil(t, json.Unmarshal(out.Bytes(), &result), "Expected JSON output, but got %s", out.String())
+	AssertEqual(t, 3, len(result["Person"]))
+	AssertEqual(t, "frank", result["Person"][0]["name"])
+
+	out.Reset()
+	s.Eval(`:sample Person { name "joe" }`)
+	result = make(map[string][]map[string]interface{})
+	AssertNil(t, json.Unmarshal(out.Bytes(), &result), "Expected JSON output, but got %s", out.String())
+	AssertEqual(t, 1, len(result["Person"]))
+	AssertEqual(t, "joe", result["Person"][0]["name"])
+}
+
+func TestSampleStillWorksAfterAnError(t *testing.T) {
+	s, out := session()
+	s.Eval(`Person: { name "frank" }`)
+	s.Eval(`:sample Nobody 1`)
+	Assert(t, strings.Contains(out.String(), `Cannot resolve symbol "Nobody"`), "Expected an error, but got %s", out.String())
+
+	out.Reset()
+	s.Eval(`:sample Person 1`)
+
+	result := make(map[string][]map[string]interface{})
+	AssertNil(t, json.Unmarshal(out.Bytes(), &result), "Expected JSON output, but got %s", out.String())
+	AssertEqual(t, 1, len(result["Person"]))
+}
+
+func TestImportsAndShow(t *testing.T) {
+	s, out := session()
+	s.Eval(`import "testdata/pets.lang"`)
+	AssertEqual(t, "Pet {\n  name  string\n}\n", out.String())
+
+	// importing again has no effect
+	out.Reset()
+	s.Eval(`import "testdata/pets.lang"`)
+	AssertEqual(t, "", out.String())
+
+	s.Eval(`Person: { pet Pet }`)
+	out.Reset()
+	s.Eval(`:show`)
+	AssertEqual(t, "Person\nPet\n", out.String())
+
+	out.Reset()
+	s.Eval(`:show Pet Nope`)
+	AssertEqual(t, "Pet {\n  name  string\n}\nCannot resolve entity \"Nope\"\n", out.String())
+
+	out.Reset()
+	s.Eval(`:reset`)
+	s.Eval(`:show`)
+	AssertEqual(t, "No entities have been defined yet\n", out.String())
+}
+
+func TestErrorsIncludeTheOffendingInput(t *testing.T) {
+	s, out := session()
+	s.Eval(`Person: { age integer(10, 1) }`)
+
+	AssertEqual(t, "<repl>:1:11: error E203: max 1 cannot be less than min 10\n  1 | Person: { age integer(10, 1) }\n    |           ^\n", out.String())
+
+	out.Reset()
+	s.Eval(`:frobnicate`)
+	AssertEqual(t, "Unknown command \":frobnicate\"; type :help for a list of commands\n", out.String())
+}
+
+func TestFailedDefinitionsAreNeitherShownNorKept(t *testing.T) {
+	s, out := session()
+	s.Eval(`Person: { name "frank" }`)
+	s.Eval(`Person: { name "joe", pet Nope }`)
+	s.Eval(`Bad: { x Nope }`)
+	Assert(t, !strings.Contains(out.String(), "Bad {"), "Didn't expect the failed definition to be shown, but got %s", out.String())
+
+	out.Reset()
+	s.Eval(`:show`)
+	AssertEqual(t, "Person\n", out.String())
+
+	out.Reset()
+	s.Eval(`:show Person`)
+	AssertEqual(t, "Person {\n  name  literal\n}\n", out.String())
+}
+
+func TestRunStopsAtQuitOrEndOfInput(t *testing.T) {
+	s, out := session()
+	AssertNil(t, s.Run(Lines(strings.NewReader("Person: {\n  name \"frank\"\n}\n:quit\n:show\n"))), "Didn't expect an error")
+	AssertEqual(t, "Person {\n  name  literal\n}\n", out.String())
+
+	s, out = session()
+	AssertNil(t, s.Run(Lines(strings.NewReader(":sample { name \"frank\" }"))), "Didn't expect an error")
+	Assert(t, strings.Contains(out.String(), `"name": "frank"`), "Expected a sample, but got %s", out.String())
+}
+
+func TestComplete(t *testing.T) {
+	Assert(t, complete(`Person: { name "frank" }`), "Expected balanced braces to be complete")
+	Assert(t, !complete("Person: {\n  name string(10)"), "Expected an open brace to be incomplete")
+	Assert(t, complete(`Person: { name "{" } # {`), "Expected braces in strings and comments to be ignored")
+	Assert(t, !complete(`generate (1, Person {`), "Expected open parentheses to be incomplete")
+	Assert(t, complete(`}`), "Expected unbalanced closing braces to be left for the interpreter to report")
+}
@@ -0,0 +1,11 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package repl
+
+import "os"
+
+// line editing isn't supported on this platform, so input is always read line by line
+func Terminal(in, out *os.File) (*Editor, bool) {
+	return nil, false
+}
@@ -0,0 +1,48 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package repl
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+/**
+ * An editor for a terminal, or false if `in` isn't one (e.g. input is piped in).
+ * The terminal is only in raw mode while a line is being read, so output written
+ * between reads behaves as usual.
+ */
+func Terminal(in, out *os.File) (*Editor, bool) {
+	fd := in.Fd()
+	original := &syscall.Termios{}
+
+	if err := ioctl(fd, getTermios, original); err != nil {
+		return nil, false
+	}
+
+	editor := NewEditor(in, out)
+	editor.raw = func() (func(), error) {
+		raw := *original
+		raw.Iflag &^= syscall.BRKINT | syscall.ICRNL | syscall.INPCK | syscall.ISTRIP | syscall.IXON
+		raw.Lflag &^= syscall.ECHO | syscall.ICANON | syscall.IEXTEN | syscall.ISIG
+		raw.Cflag |= syscall.CS8
+		raw.Cc[syscall.VMIN], raw.Cc[syscall.VTIME] = 1, 0
+
+		if err := ioctl(fd, setTermios, &raw); err != nil {
+			return nil, err
+		}
+
+		return func() { ioctl(fd, setTermios, original) }, nil
+	}
+
+	return editor, true
+}
+
+func ioctl(fd uintptr, request uintptr, termios *syscall.Termios) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, request, uintptr(unsafe.Pointer(termios))); errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/ThoughtWorksStudios/bobcat/interpreter"
+	"github.com/ThoughtWorksStudios/bobcat/repl"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const historyFile = ".bobcat_history"
+
+func runReplCommand(args []string) {
+	flags := flag.NewFlagSet("repl", flag.ExitOnError)
+	flags.Usage = func() {
+		log.Print("Usage: ./bobcat repl [ -d custom_dict_dir ]")
+		log.Print("\nEvaluates definitions interactively; type :help once started for a list of commands.\n\nOptions:")
+		flags.PrintDefaults()
+	}
+	customDicts := flags.String("d", "", "location of custom dictionary files; defaults to the current directory")
+	flags.Parse(args)
+
+	if flags.NArg() > 0 {
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	i := interpreter.New()
+
+	if *customDicts == "" {
+		wd, _ := os.Getwd()
+		i.SetCustomDictonaryPath(wd)
+	} else {
+		i.SetCustomDictonaryPath(*customDicts)
+	}
+
+	session := repl.NewSession(i, os.Stdout)
+	editor, isTerminal := repl.Terminal(os.Stdin, os.Stdout)
+
+	if !isTerminal {
+		if err := session.Run(repl.Lines(os.Stdin)); err != nil {
+			log.Fatalln(err)
+		}
+		return
+	}
+
+	history := historyPath()
+	if content, err := ioutil.ReadFile(history); history != "" && err == nil {
+		editor.SetHistory(strings.Split(strings.TrimRight(string(content), "\n"), "\n"))
+	}
+
+	fmt.Println("Welcome to bobcat! Type :help for a list of commands, or press Ctrl-D to quit.")
+	err := session.Run(editor)
+
+	// losing the history isn't worth failing over
+	if history != "" {
+		ioutil.WriteFile(history, []byte(strings.Join(editor.History(), "\n")+"\n"), 0600)
+	}
+
+	if err != nil {
+		log.Fatalln(err)
+	}
+}
+
+func historyPath() string {
+	if home := os.Getenv("HOME"); home != "" {
+		return filepath.Join(home, historyFile)
+	}
+	return ""
+}
@@ -0,0 +1,233 @@
+package spec
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func decodeInto(value interface{}, target interface{}, path string) error {
+	ptr := reflect.ValueOf(target)
+
+	if ptr.Kind() != reflect.Ptr || ptr.IsNil() {
+		return fmt.Errorf("Cannot decode into %T; expected a non-nil pointer", target)
+	}
+
+	return decode(value, ptr.Elem(), path)
+}
+
+// path describes where the value came from for error messages, e.g. Person.pets
+func decode(value interface{}, target reflect.Value, path string) error {
+	if nil == value {
+		target.Set(reflect.Zero(target.Type()))
+		return nil
+	}
+
+	if target.Kind() == reflect.Ptr {
+		elem := reflect.New(target.Type().Elem())
+		if err := decode(value, elem.Elem(), path); err != nil {
+			return err
+		}
+		target.Set(elem)
+		return nil
+	}
+
+	if target.Kind() == reflect.Interface && target.NumMethod() == 0 {
+		target.Set(reflect.ValueOf(plain(value)))
+		return nil
+	}
+
+	source := reflect.ValueOf(value)
+
+	if source.Type().AssignableTo(target.Type()) && target.Kind() != reflect.Map && target.Kind() != reflect.Slice {
+		target.Set(source)
+		return nil
+	}
+
+	switch target.Kind() {
+	case reflect.Struct:
+		if target.Type() == timeType {
+			return decodeTime(value, target, path)
+		}
+
+		entity, ok := asEntity(value)
+		if !ok {
+			return mismatch(value, target, path)
+		}
+		return decodeStruct(entity, target, path)
+	case reflect.Map:
+		entity, ok := asEntity(value)
+		if !ok || target.Type().Key().Kind() != reflect.String {
+			return mismatch(value, target, path)
+		}
+
+		result := reflect.MakeMap(target.Type())
+		for key, v := range entity {
+			elem := reflect.New(target.Type().Elem()).Elem()
+			if err := decode(v, elem, path+"."+key); err != nil {
+				return err
+			}
+			result.SetMapIndex(reflect.ValueOf(key).Convert(target.Type().Key()), elem)
+		}
+		target.Set(result)
+	case reflect.Slice:
+		values, ok := value.([]interface{})
+		if !ok {
+			values = []interface{}{value}
+		}
+
+		result := reflect.MakeSlice(target.Type(), len(values), len(values))
+		for i, v := range values {
+			if err := decode(v, result.Index(i), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+		target.Set(result)
+	case reflect.String:
+		if t, ok := value.(time.Time); ok {
+			target.SetString(t.Format(time.RFC3339))
+		} else if stringer, ok := value.(fmt.Stringer); ok {
+			target.SetString(stringer.String())
+		} else if s, ok := value.(string); ok {
+			target.SetString(s)
+		} else {
+			return mismatch(value, target, path)
+		}
+	case reflect.Bool:
+		b, ok := value.(bool)
+		if !ok {
+			return mismatch(value, target, path)
+		}
+		target.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, ok := wholeNumber(value)
+		if !ok || target.OverflowInt(n) {
+			return mismatch(value, target, path)
+		}
+		target.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, ok := wholeNumber(value)
+		if !ok || n < 0 || target.OverflowUint(uint64(n)) {
+			return mismatch(value, target, path)
+		}
+		target.SetUint(uint64(n))
+	case reflect.Float32, reflect.Float64:
+		switch n := value.(type) {
+		case int:
+			target.SetFloat(float64(n))
+		case int64:
+			target.SetFloat(float64(n))
+		case float64:
+			target.SetFloat(n)
+		default:
+			return mismatch(value, target, path)
+		}
+	default:
+		return mismatch(value, target, path)
+	}
+
+	return nil
+}
+
+func decodeStruct(entity Entity, target reflect.Value, path string) error {
+	t := target.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		if field.PkgPath != "" { // unexported
+			continue
+		}
+
+		name, ok := fieldName(field, entity)
+		if !ok {
+			continue
+		}
+
+		if err := decode(entity[name], target.Field(i), path+"."+name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// the entity field that a struct field is decoded from, if any
+func fieldName(field reflect.StructField, entity Entity) (string, bool) {
+	for _, key := range []string{"bobcat", "json"} {
+		if tag := strings.Split(field.Tag.Get(key), ",")[0]; tag == "-" {
+			return "", false
+		} else if tag != "" {
+			_, ok := entity[tag]
+			return tag, ok
+		}
+	}
+
+	for name := range entity {
+		if normalize(name) == normalize(field.Name) {
+			return name, true
+		}
+	}
+
+	return "", false
+}
+
+func normalize(name string) string {
+	return strings.ToLower(strings.Replace(name, "_", "", -1))
+}
+
+func decodeTime(value interface{}, target reflect.Value, path string) error {
+	switch v := value.(type) {
+	case time.Time:
+		target.Set(reflect.ValueOf(v))
+	case string:
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return fmt.Errorf("Cannot decode %s: %v", path, err)
+		}
+		target.Set(reflect.ValueOf(t))
+	default:
+		return mismatch(value, target, path)
+	}
+	return nil
+}
+
+func wholeNumber(value interface{}) (int64, bool) {
+	switch n := value.(type) {
+	case int:
+		return int64(n), true
+	case int64:
+		return n, true
+	case float64:
+		return int64(n), float64(int64(n)) == n
+	}
+	return 0, false
+}
+
+func mismatch(value interface{}, target reflect.Value, path string) error {
+	return fmt.Errorf("Cannot decode %s: a %T value cannot be stored in a %s", path, value, target.Type())
+}
+
+// unwraps nested entities so that values decoded into interface{} are easy to work with
+func plain(value interface{}) interface{} {
+	if entity, ok := asEntity(value); ok {
+		result := make(Entity, len(entity))
+		for key, v := range entity {
+			result[key] = plain(v)
+		}
+		return result
+	}
+
+	if values, ok := value.([]interface{}); ok {
+		result := make([]interface{}, len(values))
+		for i, v := range values {
+			result[i] = plain(v)
+		}
+		return result
+	}
+
+	return value
+}
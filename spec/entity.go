@@ -0,0 +1,135 @@
+package spec
+
+import (
+	"fmt"
+	"github.com/ThoughtWorksStudios/bobcat/generator"
+	"time"
+)
+
+/**
+ * A generated entity, keyed by field name. Values keep their Go types: strings,
+ * ints, float64s, bools, time.Times, nil for null, []interface{} for multi-value
+ * fields, and nested entities (which Entity() and Entities() unwrap). The typed
+ * accessors return the zero value when a field is missing or has another type.
+ */
+type Entity map[string]interface{}
+
+func (e Entity) ID() string {
+	return e.String("$id")
+}
+
+func (e Entity) Type() string {
+	return e.String("$type")
+}
+
+// values that aren't strings, such as $id, are formatted as they would be in JSON output
+func (e Entity) String(field string) string {
+	switch value := e[field].(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case time.Time:
+		return value.Format(time.RFC3339)
+	case fmt.Stringer:
+		return value.String()
+	default:
+		return fmt.Sprintf("%v", value)
+	}
+}
+
+func (e Entity) Int(field string) int64 {
+	switch value := e[field].(type) {
+	case int:
+		return int64(value)
+	case int64:
+		return value
+	case float64:
+		return int64(value)
+	}
+	return 0
+}
+
+func (e Entity) Float(field string) float64 {
+	switch value := e[field].(type) {
+	case int:
+		return float64(value)
+	case int64:
+		return float64(value)
+	case float64:
+		return value
+	}
+	return 0
+}
+
+func (e Entity) Bool(field string) bool {
+	value, _ := e[field].(bool)
+	return value
+}
+
+func (e Entity) Time(field string) time.Time {
+	value, _ := e[field].(time.Time)
+	return value
+}
+
+// the values of a multi-value field, or the single value of any other
+func (e Entity) Values(field string) []interface{} {
+	switch value := e[field].(type) {
+	case nil:
+		return []interface{}{}
+	case []interface{}:
+		return value
+	default:
+		return []interface{}{value}
+	}
+}
+
+// a nested entity, or nil if the field isn't one (e.g. it was cut off at the maximum nesting depth)
+func (e Entity) Entity(field string) Entity {
+	nested, _ := asEntity(e[field])
+	return nested
+}
+
+// the nested entities of a multi-value field, or of a single-value one
+func (e Entity) Entities(field string) []Entity {
+	result := make([]Entity, 0)
+
+	for _, value := range e.Values(field) {
+		if nested, ok := asEntity(value); ok {
+			result = append(result, nested)
+		}
+	}
+
+	return result
+}
+
+/**
+ * Copies the entity into target, which must point to a struct. Each exported
+ * field is filled from the entity field named by its `bobcat` tag, or else its
+ * `json` tag, or else the one with the same name ignoring case and underscores
+ * (so that CustomerSince matches customer_since); a tag of "-" skips the field.
+ * Nested entities are decoded into structs, multi-value fields into slices, and
+ * numbers into any numeric type they fit.
+ */
+func (e Entity) Decode(target interface{}) error {
+	return decodeInto(e, target, e.Type())
+}
+
+// nested entities are generated as {"Type": [entity]}
+func asEntity(value interface{}) (Entity, bool) {
+	switch v := value.(type) {
+	case Entity:
+		return v, true
+	case generator.EntityResult:
+		return Entity(v), true
+	case map[string]interface{}:
+		return Entity(v), true
+	case map[string]generator.GeneratedEntities:
+		for _, entities := range v {
+			if len(entities) == 1 {
+				return Entity(entities[0]), true
+			}
+		}
+	}
+	return nil, false
+}
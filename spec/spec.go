@@ -0,0 +1,219 @@
+/**
+ * Package spec loads bobcat specs and generates entities from them in memory,
+ * e.g. to create fixtures in Go tests without shelling out to the executable:
+ *
+ *   s, err := spec.Parse(`Person: { name dict("full_names"), age integer(18, 65) }`)
+ *
+ *   people, err := s.Generate("Person", 10)
+ *   fmt.Println(people[0].String("name"), people[0].Int("age"))
+ *
+ *   type Person struct {
+ *     ID   string `bobcat:"$id"`
+ *     Name string `bobcat:"name"`
+ *     Age  int    `bobcat:"age"`
+ *   }
+ *
+ *   var fixtures []Person
+ *   err = s.Decode("Person", 10, &fixtures)
+ *
+ * A spec's own generate statements are checked, but not run, and nothing is
+ * ever written to disk.
+ */
+package spec
+
+import (
+	"fmt"
+	"github.com/ThoughtWorksStudios/bobcat/generator"
+	"github.com/ThoughtWorksStudios/bobcat/interpreter"
+	"github.com/ThoughtWorksStudios/bobcat/logging"
+	"io"
+	"math/rand"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// errors in specs that weren't read from a file are reported as coming from this file
+const sourceName = "<spec>"
+
+// options for loading specs; the zero value is ready to use
+type Loader struct {
+	// where dict() fields look for custom dictionaries; by default, only the builtin ones are used
+	DictionaryPath string
+
+	// makes generated entities repeatable; by default (0), every run differs
+	Seed int64
+
+	// bounds entities that nest themselves; by default, generator.DefaultNestingLimit()
+	Nesting generator.NestingLimit
+}
+
+// a loaded spec, from which any of its named entities may be generated
+type Spec struct {
+	interpreter *interpreter.Interpreter
+	scope       *interpreter.Scope
+	nesting     generator.NestingLimit
+
+	lock  sync.Mutex
+	seeds *rand.Rand // seeds each call to Generate() in turn
+
+	// problems that don't prevent generation, e.g. entities that nest themselves without end
+	Warnings []string
+}
+
+func Parse(source string) (*Spec, error) {
+	return Loader{}.Parse(source)
+}
+
+func Read(r io.Reader) (*Spec, error) {
+	return Loader{}.Read(r)
+}
+
+func LoadFile(filename string) (*Spec, error) {
+	return Loader{}.LoadFile(filename)
+}
+
+// imports are resolved relative to the working directory
+func (l Loader) Parse(source string) (*Spec, error) {
+	return l.Read(strings.NewReader(source))
+}
+
+// imports are resolved relative to the working directory
+func (l Loader) Read(r io.Reader) (*Spec, error) {
+	return l.load(sourceName, r)
+}
+
+// imports are resolved relative to the file's directory
+func (l Loader) LoadFile(filename string) (*Spec, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return l.load(filename, f)
+}
+
+func (l Loader) load(filename string, r io.Reader) (*Spec, error) {
+	s := &Spec{
+		interpreter: interpreter.New(),
+		scope:       interpreter.NewRootScope(),
+		nesting:     l.Nesting,
+		Warnings:    make([]string, 0),
+		seeds:       rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+
+	if l.Seed != 0 {
+		s.seeds = rand.New(rand.NewSource(l.Seed))
+	}
+
+	if s.nesting == (generator.NestingLimit{}) {
+		s.nesting = generator.DefaultNestingLimit()
+	}
+
+	if err := s.interpreter.SetNestingLimit(s.nesting); err != nil {
+		return nil, err
+	}
+
+	s.interpreter.SetLogger(&warningCollector{spec: s})
+	if l.DictionaryPath == "" {
+		s.interpreter.UseBuiltinDictionaries()
+	} else {
+		s.interpreter.SetCustomDictonaryPath(l.DictionaryPath)
+	}
+
+	if err := s.interpreter.CheckReader(filename, r, s.scope); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+/**
+ * The names of the entities the spec defines, including those it imports, in
+ * alphabetical order; abstract entities are left out, as they can't be generated
+ */
+func (s *Spec) Entities() []string {
+	names := make([]string, 0)
+
+	for _, name := range s.scope.Names() {
+		if g, err := s.entity(name); err == nil && !g.Abstract() {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+func (s *Spec) Generate(entity string, count int) ([]Entity, error) {
+	g, err := s.entity(entity)
+	if err != nil {
+		return nil, err
+	}
+
+	if g.Abstract() {
+		return nil, fmt.Errorf("Entity %q is abstract, so only the entities that extend it may be generated", entity)
+	}
+
+	if count < 0 {
+		return nil, fmt.Errorf("Cannot generate %d %s entities", count, entity)
+	}
+
+	result := make([]Entity, 0, count)
+	opts := generator.Options{Nesting: s.nesting, Workers: 1, Seed: s.nextSeed()}
+
+	err = g.GenerateInto(int64(count), opts, func(batch generator.GeneratedEntities) error {
+		for _, e := range batch {
+			result = append(result, Entity(e))
+		}
+		return nil
+	})
+
+	return result, err
+}
+
+// specs may generate from several goroutines at once
+func (s *Spec) nextSeed() int64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.seeds.Int63()
+}
+
+/**
+ * Generates entities into target, which must point to a slice of structs (or of
+ * pointers to structs); see Entity.Decode() for how fields are matched
+ */
+func (s *Spec) Decode(entity string, count int, target interface{}) error {
+	entities, err := s.Generate(entity, count)
+	if err != nil {
+		return err
+	}
+
+	values := make([]interface{}, len(entities))
+	for i, e := range entities {
+		values[i] = e
+	}
+
+	return decodeInto(values, target, entity)
+}
+
+// anonymous entities are given $-prefixed names, which can't be referred to
+func (s *Spec) entity(name string) (*generator.Generator, error) {
+	if entry := s.scope.ResolveSymbol(name); nil != entry && !strings.HasPrefix(name, "$") {
+		if g, ok := entry.Value.(*generator.Generator); ok {
+			return g, nil
+		}
+	}
+
+	return nil, fmt.Errorf("The spec doesn't define an entity named %q", name)
+}
+
+type warningCollector struct {
+	logging.DefaultLogger
+	spec *Spec
+}
+
+func (w *warningCollector) Warn(msg string, tokens ...interface{}) {
+	w.spec.Warnings = append(w.spec.Warnings, fmt.Sprintf(msg, tokens...))
+}
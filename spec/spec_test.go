@@ -0,0 +1,204 @@
+package spec
+
+import (
+	"fmt"
+	"github.com/ThoughtWorksStudios/bobcat/generator"
+	. "github.com/ThoughtWorksStudios/bobcat/test_helpers"
+	"strings"
+	"testing"
+	"time"
+)
+
+type pet struct {
+	Name       string
+	Weight     float32 `bobcat:"weight"`
+	Vaccinated bool
+}
+
+type person struct {
+	ID            string `bobcat:"$id"`
+	Name          string `json:"name"`
+	Age           uint8
+	CustomerSince time.Time
+	Pet           *pet
+	Friends       []pet
+	Ignored       string `bobcat:"-"`
+	Missing       int    `bobcat:"shoe_size"`
+	secret        string
+}
+
+func TestGenerateReturnsTypedEntities(t *testing.T) {
+	s, err := Parse(`Person: {
+  name "frank",
+  age  integer(18, 65),
+  dob  date(1970-01-01, 1999-12-31),
+  pet  { name "rex" },
+  tags dict("colors")[2, 2]
+}`)
+	AssertNil(t, err, "Didn't expect an error: %v", err)
+
+	people, err := s.Generate("Person", 3)
+	AssertNil(t, err, "Didn't expect an error: %v", err)
+	AssertEqual(t, 3, len(people))
+
+	p := people[0]
+	AssertEqual(t, 36, len(p.ID()))
+	AssertEqual(t, "Person", p.Type())
+	AssertEqual(t, "frank", p.String("name"))
+	Assert(t, p.Int("age") >= 18 && p.Int("age") <= 65, "Expected an age between 18 and 65, but got %d", p.Int("age"))
+	Assert(t, p.Time("dob").Year() >= 1970 && p.Time("dob").Year() <= 1999, "Unexpected dob %v", p.Time("dob"))
+	AssertEqual(t, "rex", p.Entity("pet").String("name"))
+	AssertEqual(t, p.ID(), p.Entity("pet").String("$parent"))
+	AssertEqual(t, 2, len(p.Values("tags")))
+	AssertEqual(t, 1, len(p.Entities("pet")))
+	AssertEqual(t, int64(0), p.Int("nope"))
+}
+
+func TestDecodeIntoStructs(t *testing.T) {
+	s, err := LoadFile("testdata/people.lang")
+	AssertNil(t, err, "Didn't expect an error: %v", err)
+	AssertEqual(t, "Person Pet", strings.Join(s.Entities(), " "))
+
+	var people []person
+	AssertNil(t, s.Decode("Person", 2, &people), "Didn't expect an error decoding")
+	AssertEqual(t, 2, len(people))
+
+	p := people[0]
+	AssertEqual(t, 36, len(p.ID))
+	Assert(t, p.Name != "", "Expected a name")
+	Assert(t, p.Age >= 18 && p.Age <= 65, "Expected an age between 18 and 65, but got %d", p.Age)
+	Assert(t, p.CustomerSince.Year() >= 2010 && p.CustomerSince.Year() <= 2017, "Unexpected customer_since %v", p.CustomerSince)
+	AssertEqual(t, "rex", p.Pet.Name)
+	Assert(t, p.Pet.Weight >= 1 && p.Pet.Weight <= 31, "Unexpected weight %v", p.Pet.Weight)
+	Assert(t, p.Pet.Vaccinated, "Expected the pet to be vaccinated")
+	AssertEqual(t, 2, len(p.Friends))
+	AssertEqual(t, "rex", p.Friends[1].Name)
+	AssertEqual(t, "", p.Ignored)
+	AssertEqual(t, 0, p.Missing)
+
+	var loose []map[string]interface{}
+	AssertNil(t, s.Decode("Pet", 1, &loose), "Didn't expect an error decoding")
+	AssertEqual(t, "rex", loose[0]["name"])
+}
+
+func TestDecodeErrors(t *testing.T) {
+	s, _ := Parse(`Thing: { size integer(300, 400), label "x" }`)
+
+	var small []struct{ Size int8 }
+	ExpectsError(t, "Cannot decode Thing[0].size: a int value cannot be stored in a int8", s.Decode("Thing", 1, &small))
+
+	var wrong []struct{ Label bool }
+	ExpectsError(t, "Cannot decode Thing[0].label: a string value cannot be stored in a bool", s.Decode("Thing", 1, &wrong))
+
+	ExpectsError(t, "Cannot decode into []struct { Label bool }; expected a non-nil pointer", s.Decode("Thing", 1, wrong))
+	ExpectsError(t, `The spec doesn't define an entity named "Nope"`, s.Decode("Nope", 1, &wrong))
+}
+
+func TestAbstractEntitiesCannotBeGenerated(t *testing.T) {
+	s, err := Parse(`abstract Animal: { legs 4 }
+Dog: Animal { says "woof" }`)
+	AssertNil(t, err, "Didn't expect an error: %v", err)
+	AssertEqual(t, "Dog", strings.Join(s.Entities(), " "))
+
+	_, err = s.Generate("Animal", 1)
+	ExpectsError(t, `Entity "Animal" is abstract, so only the entities that extend it may be generated`, err)
+
+	var animals []struct{ Legs int }
+	ExpectsError(t, `Entity "Animal" is abstract, so only the entities that extend it may be generated`, s.Decode("Animal", 1, &animals))
+
+	dogs, err := s.Generate("Dog", 1)
+	AssertNil(t, err, "Didn't expect an error: %v", err)
+	AssertEqual(t, int64(4), dogs[0].Int("legs"))
+}
+
+func TestLoadErrorsAndOptions(t *testing.T) {
+	_, err := Parse(`Person: { age integer(10, 1) }`)
+	ExpectsError(t, "<spec>:1:11 [byte 10] max 1 cannot be less than min 10", err)
+
+	_, err = Loader{Nesting: generator.NestingLimit{MaxDepth: 0, Truncate: "drop"}}.Parse(`Person: {}`)
+	Assert(t, nil != err, "Expected an invalid nesting limit to be rejected")
+
+	s, err := Loader{DictionaryPath: "testdata", Nesting: generator.NestingLimit{MaxDepth: 2, Truncate: generator.TruncateWithNull}}.Read(strings.NewReader(`Person: { color dict("fur_colors"), friend Person }
+generate (1, Person)`))
+	AssertNil(t, err, "Didn't expect an error: %v", err)
+	AssertEqual(t, 1, len(s.Warnings))
+
+	people, _ := s.Generate("Person", 1)
+	AssertEqual(t, "red", people[0].String("color"))
+	AssertEqual(t, "red", people[0].Entity("friend").String("color"))
+	Assert(t, nil == people[0].Entity("friend").Entity("friend"), "Expected nesting to be cut off after 2 levels")
+
+	s, err = Parse(`Person: { friend Person }`)
+	AssertNil(t, err, "Didn't expect an error: %v", err)
+	AssertEqual(t, 1, len(s.Warnings), "Expected endless nesting to be reported without a generate statement")
+}
+
+func TestDictionariesAreBuiltinUnlessAPathIsGiven(t *testing.T) {
+	source := `Person: { color dict("testdata/fur_colors") }`
+
+	_, err := Parse(source)
+	Assert(t, nil != err, "Expected dictionaries in the working directory to be ignored")
+
+	_, err = Loader{DictionaryPath: "."}.Parse(source)
+	AssertNil(t, err, "Didn't expect an error: %v", err)
+}
+
+func TestSeededSpecsGenerateTheSameEntities(t *testing.T) {
+	source := `Pet: { name dict("first_names") }
+Person: { name dict("full_names"), age integer(1, 1000000), pets Pet[1, 5] }`
+
+	generate := func(l Loader) string {
+		s, err := l.Parse(source)
+		AssertNil(t, err, "Didn't expect an error: %v", err)
+
+		people, err := s.Generate("Person", 20)
+		AssertNil(t, err, "Didn't expect an error: %v", err)
+
+		more, _ := s.Generate("Person", 5)
+		return fmt.Sprintf("%v %v", people, more)
+	}
+
+	AssertEqual(t, generate(Loader{Seed: 42}), generate(Loader{Seed: 42}))
+	Assert(t, generate(Loader{Seed: 42}) != generate(Loader{Seed: 7}), "Expected different seeds to generate different entities")
+}
+
+func TestSpecsGenerateIndependentlyInParallel(t *testing.T) {
+	source := `Person: { color dict("colors"), pet { name "rex" } }`
+
+	custom, err := Loader{DictionaryPath: "testdata/palette"}.Parse(source)
+	AssertNil(t, err, "Didn't expect an error: %v", err)
+
+	builtin, err := Parse(source)
+	AssertNil(t, err, "Didn't expect an error: %v", err)
+
+	done := make(chan []string)
+
+	for n := 0; n < 8; n++ {
+		s := custom
+		if n%2 == 1 {
+			s = builtin
+		}
+
+		go func(s *Spec) {
+			people, _ := s.Generate("Person", 50)
+			problems := make([]string, 0)
+
+			for _, p := range people {
+				if plaid := p.String("color") == "plaid"; plaid != (s == custom) {
+					problems = append(problems, "unexpected color "+p.String("color"))
+				}
+
+				if p.Entity("pet").String("$parent") != p.ID() {
+					problems = append(problems, "pet has the wrong $parent")
+				}
+			}
+
+			done <- problems
+		}(s)
+	}
+
+	for n := 0; n < 8; n++ {
+		problems := <-done
+		Assert(t, len(problems) == 0, "Expected each spec to use its own dictionary, but got %v", problems)
+	}
+}
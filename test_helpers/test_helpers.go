@@ -117,6 +117,10 @@ func (l *TestLogger) Messages() []string {
 	return l.messages
 }
 
+func (l *TestLogger) Warnings() []string {
+	return l.warnings
+}
+
 func GetLogger(t *testing.T) *TestLogger {
 	return &TestLogger{t: t, messages: make([]string, 0), warnings: make([]string, 0)}
 }